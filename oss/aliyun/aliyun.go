@@ -2,20 +2,25 @@ package aliyun
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"path"
 	"strings"
 	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	difyoss "github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 )
 
 type AliyunOSSStorage struct {
 	client *oss.Client
 	bucket *oss.Bucket
-	path   string
+	// region is the region of the client, the one of the endpoint if not set
+	region string
+	ctx    context.Context
 }
 
 func NewAliyunOSSStorage(args difyoss.OSSArgs) (difyoss.OSS, error) {
@@ -34,7 +39,6 @@ func NewAliyunOSSStorage(args difyoss.OSSArgs) (difyoss.OSS, error) {
 	accessKeyID := args.AliyunOSS.AccessKey
 	accessKeySecret := args.AliyunOSS.SecretKey
 	authVersion := args.AliyunOSS.AuthVersion
-	path := args.AliyunOSS.Path
 	bucketName := args.AliyunOSS.Bucket
 	cloudboxId := args.AliyunOSS.CloudBoxId
 
@@ -60,6 +64,14 @@ func NewAliyunOSSStorage(args difyoss.OSSArgs) (difyoss.OSS, error) {
 		options = append(options, oss.AuthVersion(oss.AuthV4))
 	}
 
+	httpClient, err := args.AliyunOSS.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		options = append(options, oss.HTTPClient(httpClient))
+	}
+
 	// create client
 	var client *oss.Client
 
@@ -75,32 +87,88 @@ func NewAliyunOSSStorage(args difyoss.OSSArgs) (difyoss.OSS, error) {
 		return nil, difyoss.ErrProviderInit.WithError(err).WithDetail(fmt.Sprintf("failed to get bucket %s", bucketName))
 	}
 
-	// normalize path: remove leading slash, ensure trailing slash
-	path = strings.TrimPrefix(path, "/")
-	if path != "" && !strings.HasSuffix(path, "/") {
-		path = path + "/"
-	}
-
-	return &AliyunOSSStorage{
+	storage := &AliyunOSSStorage{
 		client: client,
 		bucket: bucket,
-		path:   path,
-	}, nil
+		region: region,
+		ctx:    context.Background(),
+	}
+	if storage.region == "" {
+		storage.region = endpointRegion(endpoint)
+	}
+	err = storage.EnsureBucket(args.AliyunOSS.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	// the keys are scoped to path by the prefix wrapper
+	return prefix.Wrap(storage, args.AliyunOSS.Path)
+}
+
+// endpointRegion returns the region of an endpoint like
+// oss-cn-hangzhou.aliyuncs.com or oss-cn-hangzhou-internal.aliyuncs.com
+func endpointRegion(endpoint string) string {
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	label, _, _ := strings.Cut(host, ".")
+	region, ok := strings.CutPrefix(label, "oss-")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSuffix(region, "-internal")
+}
+
+// EnsureBucket applies the provisioning to the bucket, the region of a new
+// bucket is always the one of the endpoint, so a different Region is rejected
+func (s *AliyunOSSStorage) EnsureBucket(provisioning difyoss.BucketProvisioning) error {
+	if err := provisioning.CheckRegion(s.region); err != nil {
+		return err
+	}
+	return provisioning.Ensure(s.bucket.BucketName, func() (bool, error) {
+		return s.client.IsBucketExist(s.bucket.BucketName)
+	}, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *AliyunOSSStorage) createBucket(provisioning difyoss.BucketProvisioning) error {
+	var options []oss.Option
+	if provisioning.ACL != "" {
+		options = append(options, oss.ACL(oss.ACLType(provisioning.ACL)))
+	}
+	err := s.client.CreateBucket(s.bucket.BucketName, options...)
+	if err != nil {
+		return err
+	}
+
+	if provisioning.Versioning {
+		return s.client.SetBucketVersioning(s.bucket.BucketName, oss.VersioningConfig{
+			Status: string(oss.VersionEnabled),
+		})
+	}
+	return nil
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *AliyunOSSStorage) WithContext(ctx context.Context) difyoss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
 }
 
-// combine full object path
+// fullPath cleans the key like the driver always did, so "a//b" and "./a"
+// keep addressing "a/b" and "a"
 func (s *AliyunOSSStorage) fullPath(key string) string {
-	return path.Join(s.path, key)
+	return path.Join(key)
 }
 
 func (s *AliyunOSSStorage) Save(key string, data []byte) error {
-	fullPath := s.fullPath(key)
-	return s.bucket.PutObject(fullPath, bytes.NewReader(data))
+	return s.bucket.PutObject(s.fullPath(key), bytes.NewReader(data), oss.WithContext(s.ctx))
 }
 
 func (s *AliyunOSSStorage) Load(key string) ([]byte, error) {
-	fullPath := s.fullPath(key)
-	object, err := s.bucket.GetObject(fullPath)
+	object, err := s.bucket.GetObject(s.fullPath(key), oss.WithContext(s.ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -115,13 +183,11 @@ func (s *AliyunOSSStorage) Load(key string) ([]byte, error) {
 }
 
 func (s *AliyunOSSStorage) Exists(key string) (bool, error) {
-	fullPath := s.fullPath(key)
-	return s.bucket.IsObjectExist(fullPath)
+	return s.bucket.IsObjectExist(s.fullPath(key), oss.WithContext(s.ctx))
 }
 
 func (s *AliyunOSSStorage) State(key string) (difyoss.OSSState, error) {
-	fullPath := s.fullPath(key)
-	meta, err := s.bucket.GetObjectMeta(fullPath)
+	meta, err := s.bucket.GetObjectMeta(s.fullPath(key), oss.WithContext(s.ctx))
 	if err != nil {
 		return difyoss.OSSState{}, err
 	}
@@ -151,22 +217,22 @@ func (s *AliyunOSSStorage) State(key string) (difyoss.OSSState, error) {
 	return difyoss.OSSState{
 		Size:         size,
 		LastModified: lastModified,
+		ETag:         meta.Get("ETag"),
 	}, nil
 }
 
 func (s *AliyunOSSStorage) List(prefix string) ([]difyoss.OSSPath, error) {
-	// combine given prefix with path
 	fullPrefix := s.fullPath(prefix)
 
-	// Ensure the prefix ends with a slash for directories
-	if !strings.HasSuffix(fullPrefix, "/") {
+	// Ensure the prefix ends with a slash for directories, an empty prefix lists the bucket
+	if fullPrefix != "" && !strings.HasSuffix(fullPrefix, "/") {
 		fullPrefix = fullPrefix + "/"
 	}
 
 	var keys []difyoss.OSSPath
 	marker := ""
 	for {
-		lsRes, err := s.bucket.ListObjects(oss.Marker(marker), oss.Prefix(fullPrefix))
+		lsRes, err := s.bucket.ListObjects(oss.Marker(marker), oss.Prefix(fullPrefix), oss.WithContext(s.ctx))
 		if err != nil {
 			return nil, fmt.Errorf("failed to list objects in Aliyun OSS: %w", err)
 		}
@@ -175,7 +241,7 @@ func (s *AliyunOSSStorage) List(prefix string) ([]difyoss.OSSPath, error) {
 			if object.Key == fullPrefix {
 				continue
 			}
-			// remove path and prefix from full path, only keep relative path
+			// remove prefix from full path, only keep relative path
 			key := strings.TrimPrefix(object.Key, fullPrefix)
 			// Skip empty keys and directories (keys ending with /)
 			if key == "" || strings.HasSuffix(key, "/") {
@@ -199,8 +265,7 @@ func (s *AliyunOSSStorage) List(prefix string) ([]difyoss.OSSPath, error) {
 }
 
 func (s *AliyunOSSStorage) Delete(key string) error {
-	fullPath := s.fullPath(key)
-	return s.bucket.DeleteObject(fullPath)
+	return s.bucket.DeleteObject(s.fullPath(key), oss.WithContext(s.ctx))
 }
 
 func (s *AliyunOSSStorage) Type() string {
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+// RedactedKey replaces the keys matching a redaction pattern
+const RedactedKey = "[REDACTED]"
+
+// Identity describes the caller of an operation
+type Identity struct {
+	// Subject is the user, service or api key performing the operation
+	Subject string
+	// Tenant is the workspace the subject acts for
+	Tenant string
+	// Attrs are logged along with the identity
+	Attrs []slog.Attr
+}
+
+func (i Identity) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(i.Attrs)+2)
+	if i.Subject != "" {
+		attrs = append(attrs, slog.String("subject", i.Subject))
+	}
+	if i.Tenant != "" {
+		attrs = append(attrs, slog.String("tenant", i.Tenant))
+	}
+	attrs = append(attrs, i.Attrs...)
+	return slog.GroupValue(attrs...)
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a context carrying the identity of the caller
+func ContextWithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored by ContextWithIdentity
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+type Options struct {
+	// Logger receives the records, slog.Default() is used by default
+	Logger *slog.Logger
+	// Level of the records of successful operations, failures are logged at warn level at least
+	Level slog.Level
+	// LogReads also logs Load, Exists, State and List, only mutations are logged by default
+	LogReads bool
+	// Identity extracts the caller from the context bound with WithContext,
+	// IdentityFromContext is used by default
+	Identity func(ctx context.Context) (Identity, bool)
+	// Redact lists the patterns of the keys which must not appear in the logs
+	Redact []*regexp.Regexp
+}
+
+// AuditStorage writes a structured record for every mutation of a storage
+type AuditStorage struct {
+	inner oss.OSS
+	opts  Options
+	ctx   context.Context
+}
+
+func NewAuditStorage(inner oss.OSS, opts Options) *AuditStorage {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Identity == nil {
+		opts.Identity = IdentityFromContext
+	}
+	return &AuditStorage{
+		inner: inner,
+		opts:  opts,
+		ctx:   context.Background(),
+	}
+}
+
+func (a *AuditStorage) WithContext(ctx context.Context) oss.OSS {
+	return &AuditStorage{
+		inner: oss.WithContext(ctx, a.inner),
+		opts:  a.opts,
+		ctx:   ctx,
+	}
+}
+
+func (a *AuditStorage) Unwrap() oss.OSS {
+	return a.inner
+}
+
+func (a *AuditStorage) redact(key string) string {
+	for _, pattern := range a.opts.Redact {
+		if pattern.MatchString(key) {
+			return RedactedKey
+		}
+	}
+	return key
+}
+
+// redactError removes a redacted key from the error, the errors of the SDKs
+// usually contain the key or the url of the object
+func (a *AuditStorage) redactError(key string, err error) string {
+	text := err.Error()
+	if key == "" || a.redact(key) != RedactedKey {
+		return text
+	}
+	for _, variant := range []string{key, url.PathEscape(key), url.QueryEscape(key), (&url.URL{Path: key}).EscapedPath()} {
+		text = strings.ReplaceAll(text, variant, RedactedKey)
+	}
+	for _, pattern := range a.opts.Redact {
+		text = pattern.ReplaceAllString(text, RedactedKey)
+	}
+	return text
+}
+
+func (a *AuditStorage) log(op oss.Operation, key string, size int64, start time.Time, err error) {
+	if !op.IsMutation() && !a.opts.LogReads {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("operation", string(op)),
+		slog.String("type", a.inner.Type()),
+		slog.String("key", a.redact(key)),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if size >= 0 {
+		attrs = append(attrs, slog.Int64("size", size))
+	}
+	if identity, ok := a.opts.Identity(a.ctx); ok {
+		attrs = append(attrs, slog.Any("identity", identity))
+	}
+
+	level := a.opts.Level
+	if err != nil {
+		attrs = append(attrs, slog.String("outcome", "error"), slog.String("error", a.redactError(key, err)))
+		level = max(level, slog.LevelWarn)
+	} else {
+		attrs = append(attrs, slog.String("outcome", "success"))
+	}
+	a.opts.Logger.LogAttrs(a.ctx, level, "oss audit", attrs...)
+}
+
+func (a *AuditStorage) Save(key string, data []byte) error {
+	start := time.Now()
+	err := a.inner.Save(key, data)
+	a.log(oss.OperationSave, key, int64(len(data)), start, err)
+	return err
+}
+
+func (a *AuditStorage) Load(key string) ([]byte, error) {
+	start := time.Now()
+	data, err := a.inner.Load(key)
+	a.log(oss.OperationLoad, key, int64(len(data)), start, err)
+	return data, err
+}
+
+func (a *AuditStorage) Exists(key string) (bool, error) {
+	start := time.Now()
+	exists, err := a.inner.Exists(key)
+	a.log(oss.OperationExists, key, -1, start, err)
+	return exists, err
+}
+
+func (a *AuditStorage) State(key string) (oss.OSSState, error) {
+	start := time.Now()
+	state, err := a.inner.State(key)
+	a.log(oss.OperationState, key, state.Size, start, err)
+	return state, err
+}
+
+func (a *AuditStorage) List(prefix string) ([]oss.OSSPath, error) {
+	start := time.Now()
+	paths, err := a.inner.List(prefix)
+	a.log(oss.OperationList, prefix, -1, start, err)
+	return paths, err
+}
+
+func (a *AuditStorage) Delete(key string) error {
+	start := time.Now()
+	err := a.inner.Delete(key)
+	a.log(oss.OperationDelete, key, -1, start, err)
+	return err
+}
+
+func (a *AuditStorage) Type() string {
+	return a.inner.Type()
+}
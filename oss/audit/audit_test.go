@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		result = append(result, record)
+	}
+	return result
+}
+
+func TestAuditStorage(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	storage := NewAuditStorage(inner, Options{
+		Logger: slog.New(slog.NewJSONHandler(buf, nil)),
+		Redact: []*regexp.Regexp{regexp.MustCompile(`^secrets/`)},
+	})
+
+	ctx := ContextWithIdentity(context.Background(), Identity{Subject: "user-1", Tenant: "workspace-1"})
+	audited := oss.WithContext(ctx, storage)
+	assert.Nil(t, audited.Save("files/a.txt", []byte("hello")))
+	_, err = audited.Load("files/a.txt")
+	assert.Nil(t, err)
+	assert.Nil(t, audited.Save("secrets/token", []byte("x")))
+	assert.Nil(t, audited.Delete("files/a.txt"))
+
+	logged := records(t, buf)
+	assert.Equal(t, 3, len(logged))
+
+	assert.Equal(t, "save", logged[0]["operation"])
+	assert.Equal(t, "files/a.txt", logged[0]["key"])
+	assert.Equal(t, float64(5), logged[0]["size"])
+	assert.Equal(t, "success", logged[0]["outcome"])
+	assert.Equal(t, map[string]any{"subject": "user-1", "tenant": "workspace-1"}, logged[0]["identity"])
+
+	assert.Equal(t, RedactedKey, logged[1]["key"])
+	assert.Equal(t, "delete", logged[2]["operation"])
+}
+
+func TestAuditStorageReadsAndFailures(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	storage := NewAuditStorage(inner, Options{
+		Logger:   slog.New(slog.NewJSONHandler(buf, nil)),
+		LogReads: true,
+	})
+
+	_, err = storage.Load("missing")
+	assert.NotNil(t, err)
+
+	logged := records(t, buf)
+	assert.Equal(t, 1, len(logged))
+	assert.Equal(t, "WARN", logged[0]["level"])
+	assert.Equal(t, "error", logged[0]["outcome"])
+	assert.Nil(t, logged[0]["identity"])
+}
+
+func TestAuditStorageRedactsErrors(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	storage := NewAuditStorage(inner, Options{
+		Logger:   slog.New(slog.NewJSONHandler(buf, nil)),
+		LogReads: true,
+		Redact:   []*regexp.Regexp{regexp.MustCompile(`^secrets/`)},
+	})
+
+	// the error of the local storage contains the path of the key
+	_, err = storage.Load("secrets/api token")
+	assert.Contains(t, err.Error(), "secrets/api token")
+	_, err = storage.Load("files/missing")
+	assert.NotNil(t, err)
+
+	logged := records(t, buf)
+	assert.Equal(t, 2, len(logged))
+	assert.Equal(t, RedactedKey, logged[0]["key"])
+	assert.NotContains(t, logged[0]["error"], "secrets/api token")
+	assert.Contains(t, logged[0]["error"], RedactedKey)
+	assert.Contains(t, logged[1]["error"], "files/missing")
+}
@@ -6,12 +6,16 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 )
 
 type AzureBlobStorage struct {
 	client        *azblob.Client
 	containerName string
+	ctx           context.Context
 }
 
 func NewAzureBlobStorage(args oss.OSSArgs) (oss.OSS, error) {
@@ -24,30 +28,89 @@ func NewAzureBlobStorage(args oss.OSSArgs) (oss.OSS, error) {
 	}
 	connectionString := args.AzureBlob.ConnectionString
 	containerName := args.AzureBlob.ContainerName
-	client, err := azblob.NewClientFromConnectionString(connectionString, nil)
+	httpClient, err := args.AzureBlob.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	var options *azblob.ClientOptions
+	if httpClient != nil {
+		options = &azblob.ClientOptions{}
+		options.Transport = httpClient
+	}
+	client, err := azblob.NewClientFromConnectionString(connectionString, options)
 	if err != nil {
 		return nil, oss.ErrProviderInit.WithError(err)
 	}
 
-	return &AzureBlobStorage{
+	storage := &AzureBlobStorage{
 		client:        client,
 		containerName: containerName,
-	}, nil
+		ctx:           context.Background(),
+	}
+	err = storage.EnsureBucket(args.AzureBlob.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.AzureBlob.Prefix)
+}
+
+func (a *AzureBlobStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(a.containerName, a.containerExists, func() error {
+		return a.createContainer(provisioning)
+	})
+}
+
+func (a *AzureBlobStorage) containerExists() (bool, error) {
+	containerClient := a.client.ServiceClient().NewContainerClient(a.containerName)
+	_, err := containerClient.GetProperties(context.TODO(), nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *AzureBlobStorage) createContainer(provisioning oss.BucketProvisioning) error {
+	// versioning is configured on the storage account instead of the container
+	if provisioning.Versioning {
+		return oss.ErrArgumentInvalid.Errorf("versioning is not supported on azure blob containers")
+	}
+	options := &azblob.CreateContainerOptions{}
+	// containers are private unless public access is requested
+	switch provisioning.ACL {
+	case "", "private":
+	case string(container.PublicAccessTypeBlob), string(container.PublicAccessTypeContainer):
+		access := container.PublicAccessType(provisioning.ACL)
+		options.Access = &access
+	default:
+		return oss.ErrArgumentInvalid.Errorf("unknown azure blob access type %q", provisioning.ACL)
+	}
+	_, err := a.client.CreateContainer(context.TODO(), a.containerName, options)
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (a *AzureBlobStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *a
+	storage.ctx = ctx
+	return &storage
 }
 
 func (a *AzureBlobStorage) Save(key string, data []byte) error {
-	_, err := a.client.UploadBuffer(context.TODO(), a.containerName, key, data, nil)
+	_, err := a.client.UploadBuffer(a.ctx, a.containerName, key, data, nil)
 	return err
 }
 
 func (a *AzureBlobStorage) Load(key string) ([]byte, error) {
-	get, err := a.client.DownloadStream(context.TODO(), a.containerName, key, nil)
+	get, err := a.client.DownloadStream(a.ctx, a.containerName, key, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	downloadedData := bytes.Buffer{}
-	retryReader := get.NewRetryReader(context.TODO(), &azblob.RetryReaderOptions{})
+	retryReader := get.NewRetryReader(a.ctx, &azblob.RetryReaderOptions{})
 	_, err = downloadedData.ReadFrom(retryReader)
 	if err != nil {
 		return nil, err
@@ -63,7 +126,7 @@ func (a *AzureBlobStorage) Load(key string) ([]byte, error) {
 
 func (a *AzureBlobStorage) Exists(key string) (bool, error) {
 	blobClient := a.client.ServiceClient().NewContainerClient(a.containerName).NewBlobClient(key)
-	_, err := blobClient.GetProperties(context.TODO(), nil)
+	_, err := blobClient.GetProperties(a.ctx, nil)
 
 	if err != nil {
 		if strings.Contains(err.Error(), "404") {
@@ -77,21 +140,27 @@ func (a *AzureBlobStorage) Exists(key string) (bool, error) {
 
 func (a *AzureBlobStorage) State(key string) (oss.OSSState, error) {
 	blobClient := a.client.ServiceClient().NewContainerClient(a.containerName).NewBlobClient(key)
-	props, err := blobClient.GetProperties(context.TODO(), nil)
+	props, err := blobClient.GetProperties(a.ctx, nil)
 
 	if err != nil {
 		return oss.OSSState{}, err
 	}
 
+	etag := ""
+	if props.ETag != nil {
+		etag = string(*props.ETag)
+	}
+
 	return oss.OSSState{
 		Size:         *props.ContentLength,
 		LastModified: *props.LastModified,
+		ETag:         etag,
 	}, nil
 }
 
 func (a *AzureBlobStorage) List(prefix string) ([]oss.OSSPath, error) {
-	// append a slash to the prefix if it doesn't end with one
-	if !strings.HasSuffix(prefix, "/") {
+	// append a slash to the prefix if it doesn't end with one, an empty prefix lists the container
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 
@@ -101,7 +170,7 @@ func (a *AzureBlobStorage) List(prefix string) ([]oss.OSSPath, error) {
 
 	paths := make([]oss.OSSPath, 0)
 	for pager.More() {
-		page, err := pager.NextPage(context.TODO())
+		page, err := pager.NextPage(a.ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -122,7 +191,7 @@ func (a *AzureBlobStorage) List(prefix string) ([]oss.OSSPath, error) {
 }
 
 func (a *AzureBlobStorage) Delete(key string) error {
-	_, err := a.client.DeleteBlob(context.TODO(), a.containerName, key, nil)
+	_, err := a.client.DeleteBlob(a.ctx, a.containerName, key, nil)
 	return err
 }
 
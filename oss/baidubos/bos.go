@@ -0,0 +1,213 @@
+package baidubos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/baidubce/bce-sdk-go/bce"
+	"github.com/baidubce/bce-sdk-go/services/bos"
+	"github.com/baidubce/bce-sdk-go/services/bos/api"
+	"github.com/baidubce/bce-sdk-go/util"
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
+)
+
+type BaiduBOSStorage struct {
+	bucket string
+	// region is the one of the endpoint, e.g. bj for bj.bcebos.com
+	region string
+	client *bos.Client
+	ctx    context.Context
+}
+
+func NewBaiduBOSStorage(args oss.OSSArgs) (oss.OSS, error) {
+	if args.BaiduBOS == nil {
+		return nil, oss.ErrArgumentInvalid.WithDetail("can't find Baidu BOS argument in OSSArgs")
+	}
+
+	err := args.BaiduBOS.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	config := bos.NewBosClientConfig(args.BaiduBOS.AccessKey, args.BaiduBOS.SecretKey, args.BaiduBOS.Endpoint)
+	config.PathStyleEnable = args.BaiduBOS.PathStyle
+
+	httpClient, err := args.BaiduBOS.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+		if httpClient.Timeout > 0 {
+			config.HTTPClientTimeout = &httpClient.Timeout
+		}
+	}
+
+	client, err := bos.NewClientWithConfig(config)
+	if err != nil {
+		return nil, oss.ErrProviderInit.WithError(err)
+	}
+	storage := &BaiduBOSStorage{
+		bucket: args.BaiduBOS.Bucket,
+		region: endpointRegion(args.BaiduBOS.Endpoint),
+		client: client,
+		ctx:    context.Background(),
+	}
+	err = storage.EnsureBucket(args.BaiduBOS.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.BaiduBOS.Prefix)
+}
+
+// endpointRegion returns the region of an endpoint like bj.bcebos.com
+func endpointRegion(endpoint string) string {
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	region, rest, _ := strings.Cut(host, ".")
+	if rest != "bcebos.com" {
+		return ""
+	}
+	return region
+}
+
+// EnsureBucket applies the provisioning to the bucket, the region of a new
+// bucket is the one of the endpoint, so a different Region is rejected
+func (s *BaiduBOSStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	if err := provisioning.CheckRegion(s.region); err != nil {
+		return err
+	}
+	return provisioning.Ensure(s.bucket, s.bucketExists, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *BaiduBOSStorage) bucketExists() (bool, error) {
+	return s.client.DoesBucketExist(s.bucket)
+}
+
+func (s *BaiduBOSStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	_, err := s.client.PutBucket(s.bucket)
+	if err != nil {
+		return err
+	}
+
+	if provisioning.ACL != "" {
+		err = s.client.PutBucketAclFromCanned(s.bucket, provisioning.ACL)
+		if err != nil {
+			return err
+		}
+	}
+	if provisioning.Versioning {
+		err = s.client.PutBucketVersioning(s.bucket, &api.BucketVersioningArgs{Status: "enabled"})
+	}
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *BaiduBOSStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
+func isNotFound(err error) bool {
+	var bceErr *bce.BceServiceError
+	return errors.As(err, &bceErr) && bceErr.StatusCode == http.StatusNotFound
+}
+
+func (s *BaiduBOSStorage) Save(key string, data []byte) error {
+	_, err := s.client.PutObjectFromBytesWithContext(s.ctx, s.bucket, key, data, nil)
+	return err
+}
+
+func (s *BaiduBOSStorage) Load(key string) ([]byte, error) {
+	resp, err := s.client.GetObjectWithContext(s.ctx, s.bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *BaiduBOSStorage) Exists(key string) (bool, error) {
+	_, err := s.client.GetObjectMetaWithContext(s.ctx, s.bucket, key)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *BaiduBOSStorage) State(key string) (oss.OSSState, error) {
+	resp, err := s.client.GetObjectMetaWithContext(s.ctx, s.bucket, key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	lastModified, _ := util.ParseRFC822Date(resp.LastModified)
+	return oss.OSSState{
+		Size:         resp.ContentLength,
+		LastModified: lastModified,
+		ETag:         resp.ETag,
+	}, nil
+}
+
+func (s *BaiduBOSStorage) List(prefix string) ([]oss.OSSPath, error) {
+	// append a slash to the prefix if it doesn't end with one, an empty prefix lists the bucket
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	var keys []oss.OSSPath
+	marker := ""
+	for {
+		resp, err := s.client.ListObjectsWithContext(s.ctx, s.bucket, &api.ListObjectsArgs{
+			Prefix:  prefix,
+			Marker:  marker,
+			MaxKeys: 1000,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Contents {
+			// remove prefix
+			key := strings.TrimPrefix(obj.Key, prefix)
+			// remove leading slash
+			key = strings.TrimPrefix(key, "/")
+			if key == "" {
+				continue
+			}
+			keys = append(keys, oss.OSSPath{
+				Path:  key,
+				IsDir: false,
+			})
+		}
+		if !resp.IsTruncated || resp.NextMarker == "" {
+			break
+		}
+		marker = resp.NextMarker
+	}
+	return keys, nil
+}
+
+// Delete succeeds if the object does not exist
+func (s *BaiduBOSStorage) Delete(key string) error {
+	err := api.DeleteObject(s.client, s.bucket, key, "", s.client.NewBosContext(s.ctx))
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *BaiduBOSStorage) Type() string {
+	return oss.OSS_TYPE_BAIDU_BOS
+}
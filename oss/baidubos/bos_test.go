@@ -0,0 +1,201 @@
+package baidubos
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBOS serves the path style BOS API for a single bucket, the listing is
+// paginated by two keys
+type fakeBOS struct {
+	mu       sync.Mutex
+	bucket   string
+	exists   bool
+	acl      string
+	versions string
+	objects  map[string][]byte
+}
+
+func (f *fakeBOS) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": code, "requestId": "test"})
+}
+
+func (f *fakeBOS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket || (!f.exists && !(key == "" && r.Method == http.MethodPut)) {
+		f.fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Query().Has("acl"):
+			f.acl = r.Header.Get("x-bce-acl")
+		case r.Method == http.MethodPut && r.URL.Query().Has("versioning"):
+			body, _ := io.ReadAll(r.Body)
+			f.versions = string(body)
+		case r.Method == http.MethodPut:
+			f.exists = true
+		case r.Method == http.MethodGet:
+			f.list(w, r)
+		}
+		return
+	}
+
+	data, ok := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		w.Header().Set("ETag", etag(body))
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC).Format(http.TimeFormat))
+		w.Header().Set("ETag", etag(data))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		delete(f.objects, key)
+	}
+}
+
+func (f *fakeBOS) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	marker := r.URL.Query().Get("marker")
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := map[string]any{"name": f.bucket, "prefix": prefix, "marker": marker, "maxKeys": 2}
+	if len(keys) > 2 {
+		keys = keys[:2]
+		result["isTruncated"] = true
+		result["nextMarker"] = keys[1]
+	}
+	contents := []map[string]any{}
+	for _, key := range keys {
+		contents = append(contents, map[string]any{"key": key, "size": len(f.objects[key]), "eTag": etag(f.objects[key])})
+	}
+	result["contents"] = contents
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newStorage(t *testing.T, fake *fakeBOS, provisioning oss.BucketProvisioning) (oss.OSS, error) {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewBaiduBOSStorage(oss.OSSArgs{BaiduBOS: &oss.BaiduBOS{
+		Endpoint:     server.URL,
+		AccessKey:    "ak",
+		SecretKey:    "sk",
+		Bucket:       "dify",
+		Provisioning: provisioning,
+	}})
+}
+
+func TestBaiduBOSStorage(t *testing.T) {
+	fake := &fakeBOS{bucket: "dify", exists: true, objects: map[string][]byte{}}
+	storage, err := newStorage(t, fake, oss.BucketProvisioning{})
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSS_TYPE_BAIDU_BOS, storage.Type())
+
+	exists, err := storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = storage.Load("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+
+	for _, key := range []string{"plugins/a.pkg", "plugins/b.pkg", "plugins/c/d.pkg", "pluginsx"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("plugins/a.pkg"), data)
+
+	state, err := storage.State("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(13), state.Size)
+	assert.Equal(t, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), state.LastModified.UTC())
+	assert.Equal(t, etag([]byte("plugins/a.pkg")), state.ETag)
+
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "b.pkg"}, {Path: "c/d.pkg"}}, paths)
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	exists, err = storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestBaiduBOSProvisioning(t *testing.T) {
+	fake := &fakeBOS{bucket: "dify", objects: map[string][]byte{}}
+	_, err := newStorage(t, fake, oss.BucketProvisioning{Policy: oss.BucketPolicyRequireExisting})
+	assert.NotNil(t, err)
+
+	_, err = newStorage(t, fake, oss.BucketProvisioning{
+		Policy:     oss.BucketPolicyCreateIfMissing,
+		ACL:        "private",
+		Versioning: true,
+	})
+	assert.Nil(t, err)
+	assert.True(t, fake.exists)
+	assert.Equal(t, "private", fake.acl)
+	assert.Contains(t, fake.versions, "enabled")
+}
+
+func TestBaiduBOSProvisioningRegion(t *testing.T) {
+	assert.Equal(t, "bj", endpointRegion("bj.bcebos.com"))
+	assert.Equal(t, "gz", endpointRegion("https://gz.bcebos.com"))
+	assert.Equal(t, "", endpointRegion("http://127.0.0.1:8080"))
+
+	// the bucket can't be created outside of the region of the endpoint
+	fake := &fakeBOS{bucket: "dify", objects: map[string][]byte{}}
+	_, err := newStorage(t, fake, oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing, Region: "gz"})
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	assert.False(t, fake.exists)
+}
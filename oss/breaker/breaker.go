@@ -0,0 +1,274 @@
+package breaker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+const (
+	defaultWindow       = 10 * time.Second
+	defaultMinRequests  = 20
+	defaultFailureRatio = 0.5
+	defaultOpenTimeout  = 30 * time.Second
+	defaultProbes       = 1
+)
+
+// State is the state of the circuit
+type State string
+
+const (
+	// StateClosed lets every request through
+	StateClosed State = "closed"
+	// StateOpen rejects every request with oss.ErrCircuitOpen
+	StateOpen State = "open"
+	// StateHalfOpen lets a few probe requests through
+	StateHalfOpen State = "half_open"
+)
+
+type Options struct {
+	// Window is the period over which the failure ratio is computed, defaults to 10s
+	Window time.Duration
+	// MinRequests is the number of requests in a window before the circuit may open, defaults to 20
+	MinRequests int
+	// FailureRatio opens the circuit once reached, defaults to 0.5
+	FailureRatio float64
+	// OpenTimeout is how long the circuit stays open before probing, defaults to 30s
+	OpenTimeout time.Duration
+	// Probes is the number of successful probes which close the circuit again,
+	// it's also the number of probes allowed at once, defaults to 1
+	Probes int
+	// IsFailure decides whether an error counts against the storage, by default
+	// the throttling, unavailability and timeout errors do
+	IsFailure func(err error) bool
+	// OnStateChange is called when the circuit changes its state, it must not
+	// use the storage
+	OnStateChange func(from State, to State)
+}
+
+// Status is a snapshot of the circuit for health endpoints
+type Status struct {
+	State State
+	// Requests and Failures are counted in the current window
+	Requests int
+	Failures int
+	// Since is when the circuit entered its state
+	Since time.Time
+}
+
+type circuit struct {
+	opts Options
+	now  func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	since       time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	probes      int
+	successes   int
+}
+
+// BreakerStorage fails fast with oss.ErrCircuitOpen while the wrapped storage
+// is unhealthy. The circuit opens once the failure ratio of a window is reached,
+// after OpenTimeout a few probe requests decide whether it closes again.
+type BreakerStorage struct {
+	inner   oss.OSS
+	circuit *circuit
+}
+
+func NewBreakerStorage(inner oss.OSS, opts Options) *BreakerStorage {
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = defaultMinRequests
+	}
+	if opts.FailureRatio <= 0 || opts.FailureRatio > 1 {
+		opts.FailureRatio = defaultFailureRatio
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultOpenTimeout
+	}
+	if opts.Probes <= 0 {
+		opts.Probes = defaultProbes
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(err error) bool {
+			return errclass.Classify(err).Retryable()
+		}
+	}
+
+	now := time.Now()
+	return &BreakerStorage{
+		inner: inner,
+		circuit: &circuit{
+			opts:        opts,
+			now:         time.Now,
+			state:       StateClosed,
+			since:       now,
+			windowStart: now,
+		},
+	}
+}
+
+// setState must be called with the lock held
+func (c *circuit) setState(state State, now time.Time) {
+	from := c.state
+	c.state = state
+	c.since = now
+	c.windowStart = now
+	c.requests, c.failures = 0, 0
+	c.probes, c.successes = 0, 0
+	if c.opts.OnStateChange != nil {
+		c.opts.OnStateChange(from, state)
+	}
+}
+
+// allow reports whether a request may be sent and whether it's a probe
+func (c *circuit) allow() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	switch c.state {
+	case StateClosed:
+		if now.Sub(c.windowStart) >= c.opts.Window {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+		return false, nil
+	case StateOpen:
+		if now.Sub(c.since) < c.opts.OpenTimeout {
+			return false, oss.ErrCircuitOpen
+		}
+		c.setState(StateHalfOpen, now)
+	}
+
+	if c.probes >= c.opts.Probes {
+		return false, oss.ErrCircuitOpen
+	}
+	c.probes++
+	return true, nil
+}
+
+func (c *circuit) record(probe bool, err error) {
+	failure := err != nil && c.opts.IsFailure(err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	switch {
+	case probe && c.state == StateHalfOpen:
+		if failure {
+			c.setState(StateOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= c.opts.Probes {
+			c.setState(StateClosed, now)
+		}
+	case !probe && c.state == StateClosed:
+		// the requests started before the circuit changed its state are ignored
+		c.requests++
+		if failure {
+			c.failures++
+		}
+		if c.requests >= c.opts.MinRequests &&
+			float64(c.failures) >= c.opts.FailureRatio*float64(c.requests) {
+			c.setState(StateOpen, now)
+		}
+	}
+}
+
+func (c *circuit) status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.state
+	// an expired open circuit is reported as half open, the next request probes it
+	if state == StateOpen && c.now().Sub(c.since) >= c.opts.OpenTimeout {
+		state = StateHalfOpen
+	}
+	return Status{
+		State:    state,
+		Requests: c.requests,
+		Failures: c.failures,
+		Since:    c.since,
+	}
+}
+
+// WithContext returns a copy of the storage which shares the circuit with the original one
+func (b *BreakerStorage) WithContext(ctx context.Context) oss.OSS {
+	return &BreakerStorage{
+		inner:   oss.WithContext(ctx, b.inner),
+		circuit: b.circuit,
+	}
+}
+
+func (b *BreakerStorage) Unwrap() oss.OSS {
+	return b.inner
+}
+
+// Status returns the state of the circuit
+func (b *BreakerStorage) Status() Status {
+	return b.circuit.status()
+}
+
+func (b *BreakerStorage) Save(key string, data []byte) error {
+	_, err := call(b.circuit, func() (struct{}, error) {
+		return struct{}{}, b.inner.Save(key, data)
+	})
+	return err
+}
+
+func (b *BreakerStorage) Load(key string) ([]byte, error) {
+	return call(b.circuit, func() ([]byte, error) {
+		return b.inner.Load(key)
+	})
+}
+
+func (b *BreakerStorage) Exists(key string) (bool, error) {
+	return call(b.circuit, func() (bool, error) {
+		return b.inner.Exists(key)
+	})
+}
+
+func (b *BreakerStorage) State(key string) (oss.OSSState, error) {
+	return call(b.circuit, func() (oss.OSSState, error) {
+		return b.inner.State(key)
+	})
+}
+
+func (b *BreakerStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return call(b.circuit, func() ([]oss.OSSPath, error) {
+		return b.inner.List(prefix)
+	})
+}
+
+func (b *BreakerStorage) Delete(key string) error {
+	_, err := call(b.circuit, func() (struct{}, error) {
+		return struct{}{}, b.inner.Delete(key)
+	})
+	return err
+}
+
+func (b *BreakerStorage) Type() string {
+	return b.inner.Type()
+}
+
+func call[T any](c *circuit, fn func() (T, error)) (T, error) {
+	probe, err := c.allow()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := fn()
+	c.record(probe, err)
+	return result, err
+}
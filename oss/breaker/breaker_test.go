@@ -0,0 +1,101 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string       { return "status error" }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+// flakyStorage fails every operation while down is set
+type flakyStorage struct {
+	oss.OSS
+	down  bool
+	calls int
+}
+
+func (f *flakyStorage) Exists(key string) (bool, error) {
+	f.calls++
+	if f.down {
+		return false, statusError(503)
+	}
+	return f.OSS.Exists(key)
+}
+
+func newBreakerStorage(t *testing.T, opts Options) (*BreakerStorage, *flakyStorage, *time.Time) {
+	storage, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	inner := &flakyStorage{OSS: storage}
+
+	breaker := NewBreakerStorage(inner, opts)
+	now := breaker.circuit.since
+	breaker.circuit.now = func() time.Time { return now }
+	return breaker, inner, &now
+}
+
+func TestBreakerOpensAndCloses(t *testing.T) {
+	var changes []State
+	storage, inner, now := newBreakerStorage(t, Options{
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		OpenTimeout:  time.Minute,
+		OnStateChange: func(from State, to State) {
+			changes = append(changes, to)
+		},
+	})
+
+	inner.down = true
+	for i := 0; i < 4; i++ {
+		_, err := storage.Exists("a")
+		assert.Equal(t, statusError(503), err)
+	}
+	assert.Equal(t, StateOpen, storage.Status().State)
+
+	// the storage is not called while the circuit is open
+	_, err := storage.Exists("a")
+	assert.True(t, errors.Is(err, oss.ErrCircuitOpen))
+	assert.Equal(t, 4, inner.calls)
+
+	// a failed probe opens the circuit again
+	*now = now.Add(time.Minute)
+	assert.Equal(t, StateHalfOpen, storage.Status().State)
+	_, err = storage.Exists("a")
+	assert.Equal(t, statusError(503), err)
+	assert.Equal(t, StateOpen, storage.Status().State)
+
+	inner.down = false
+	*now = now.Add(time.Minute)
+	exists, err := storage.Exists("a")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, StateClosed, storage.Status().State)
+	assert.Equal(t, []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}, changes)
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	storage, _, now := newBreakerStorage(t, Options{MinRequests: 2, Window: time.Second})
+
+	// a missing object does not count against the storage
+	for i := 0; i < 5; i++ {
+		_, err := storage.Load("missing")
+		assert.NotNil(t, err)
+	}
+	status := storage.Status()
+	assert.Equal(t, StateClosed, status.State)
+	assert.Equal(t, 5, status.Requests)
+	assert.Equal(t, 0, status.Failures)
+
+	// the counts start again in every window
+	*now = now.Add(time.Second)
+	_, err := storage.Exists("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, storage.Status().Requests)
+}
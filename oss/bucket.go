@@ -0,0 +1,110 @@
+package oss
+
+// BucketPolicy decides what a driver does with its bucket during initialization
+type BucketPolicy string
+
+const (
+	// BucketPolicyNever never touches the bucket, it's the default policy
+	BucketPolicyNever BucketPolicy = "never"
+	// BucketPolicyCreateIfMissing creates the bucket when it does not exist
+	BucketPolicyCreateIfMissing BucketPolicy = "create_if_missing"
+	// BucketPolicyRequireExisting fails the initialization when the bucket does not exist
+	BucketPolicyRequireExisting BucketPolicy = "require_existing"
+)
+
+// BucketProvisioning describes how a bucket is checked and created.
+// Region, ACL and Versioning are only used when the bucket is created,
+// ACL takes the canned ACL names of the provider, e.g. private, public-read
+type BucketProvisioning struct {
+	Policy     BucketPolicy
+	Region     string
+	ACL        string
+	Versioning bool
+
+	// deferred is set by OSSArgs.DeferProvisioning
+	deferred bool
+}
+
+// Deferred reports whether the bucket is left to a later EnsureBucket call,
+// the drivers then don't check it at all while they are loaded
+func (b *BucketProvisioning) Deferred() bool {
+	return b.deferred
+}
+
+func (b *BucketProvisioning) Validate() error {
+	switch b.Policy {
+	case "", BucketPolicyNever, BucketPolicyCreateIfMissing, BucketPolicyRequireExisting:
+		return nil
+	default:
+		return ErrArgumentInvalid.Errorf("unknown bucket policy %q", b.Policy)
+	}
+}
+
+// CheckRegion rejects a Region which differs from the region of the client,
+// for the drivers which can only create the bucket in the region of their client
+func (b *BucketProvisioning) CheckRegion(region string) error {
+	if b.Region == "" || b.Region == region {
+		return nil
+	}
+	return ErrArgumentInvalid.Errorf("bucket region %q differs from the region %q of the client", b.Region, region)
+}
+
+// Ensure applies the policy, exists reports whether the bucket exists
+// and create creates it with the provisioning settings
+func (b *BucketProvisioning) Ensure(bucket string, exists func() (bool, error), create func() error) error {
+	if b.Policy == "" || b.Policy == BucketPolicyNever {
+		return nil
+	}
+
+	ok, err := exists()
+	if err != nil {
+		return ErrProviderInit.Errorf("failed to check bucket %s", bucket).WithError(err)
+	}
+	if ok {
+		return nil
+	}
+
+	if b.Policy == BucketPolicyRequireExisting {
+		return ErrBucketNotFound.Errorf("bucket %s does not exist", bucket)
+	}
+
+	if err := create(); err != nil {
+		return ErrProviderInit.Errorf("failed to create bucket %s", bucket).WithError(err)
+	}
+	return nil
+}
+
+// BucketEnsurer is implemented by the drivers which are able to check and create their bucket
+type BucketEnsurer interface {
+	// EnsureBucket applies the provisioning to the bucket of the storage
+	EnsureBucket(provisioning BucketProvisioning) error
+}
+
+// DeferProvisioning returns a copy of the args whose drivers don't touch their
+// bucket while they are loaded, so the bucket can be provisioned afterwards
+// with EnsureBucket even if it does not exist yet
+func (a OSSArgs) DeferProvisioning() OSSArgs {
+	a.S3 = deferProvisioning(a.S3, func(s *S3) *BucketProvisioning { return &s.Provisioning })
+	a.AzureBlob = deferProvisioning(a.AzureBlob, func(s *AzureBlob) *BucketProvisioning { return &s.Provisioning })
+	a.AliyunOSS = deferProvisioning(a.AliyunOSS, func(s *AliyunOSS) *BucketProvisioning { return &s.Provisioning })
+	a.TencentCOS = deferProvisioning(a.TencentCOS, func(s *TencentCOS) *BucketProvisioning { return &s.Provisioning })
+	a.GoogleCloudStorage = deferProvisioning(a.GoogleCloudStorage, func(s *GoogleCloudStorage) *BucketProvisioning { return &s.Provisioning })
+	a.HuaweiOBS = deferProvisioning(a.HuaweiOBS, func(s *HuaweiOBS) *BucketProvisioning { return &s.Provisioning })
+	a.VolcengineTOS = deferProvisioning(a.VolcengineTOS, func(s *VolcengineTOS) *BucketProvisioning { return &s.Provisioning })
+	a.BaiduBOS = deferProvisioning(a.BaiduBOS, func(s *BaiduBOS) *BucketProvisioning { return &s.Provisioning })
+	a.OCIObjectStorage = deferProvisioning(a.OCIObjectStorage, func(s *OCIObjectStorage) *BucketProvisioning { return &s.Provisioning })
+	a.Supabase = deferProvisioning(a.Supabase, func(s *Supabase) *BucketProvisioning { return &s.Provisioning })
+	a.OpenStackSwift = deferProvisioning(a.OpenStackSwift, func(s *OpenStackSwift) *BucketProvisioning { return &s.Provisioning })
+	a.WebDAV = deferProvisioning(a.WebDAV, func(s *WebDAV) *BucketProvisioning { return &s.Provisioning })
+	return a
+}
+
+// deferProvisioning copies the argument of a provider with its policy forced to never
+func deferProvisioning[T any](arg *T, provisioning func(*T) *BucketProvisioning) *T {
+	if arg == nil {
+		return nil
+	}
+	copied := *arg
+	*provisioning(&copied) = BucketProvisioning{Policy: BucketPolicyNever, deferred: true}
+	return &copied
+}
@@ -0,0 +1,63 @@
+package oss
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketProvisioningEnsure(t *testing.T) {
+	cases := []struct {
+		policy  BucketPolicy
+		exists  bool
+		created bool
+		wantErr bool
+	}{
+		{policy: "", exists: false, created: false},
+		{policy: BucketPolicyNever, exists: false, created: false},
+		{policy: BucketPolicyRequireExisting, exists: true, created: false},
+		{policy: BucketPolicyRequireExisting, exists: false, created: false, wantErr: true},
+		{policy: BucketPolicyCreateIfMissing, exists: true, created: false},
+		{policy: BucketPolicyCreateIfMissing, exists: false, created: true},
+	}
+
+	for _, c := range cases {
+		created := false
+		provisioning := BucketProvisioning{Policy: c.policy}
+		err := provisioning.Ensure("bucket", func() (bool, error) {
+			return c.exists, nil
+		}, func() error {
+			created = true
+			return nil
+		})
+		assert.Equal(t, c.wantErr, err != nil, string(c.policy))
+		assert.Equal(t, c.created, created, string(c.policy))
+	}
+}
+
+func TestBucketProvisioningEnsureErrors(t *testing.T) {
+	provisioning := BucketProvisioning{Policy: BucketPolicyCreateIfMissing}
+	err := provisioning.Ensure("bucket", func() (bool, error) {
+		return false, errors.New("forbidden")
+	}, func() error {
+		t.Fatal("bucket must not be created when the check fails")
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrProviderInit))
+	assert.Equal(t, "", ErrProviderInit.Detail)
+
+	provisioning = BucketProvisioning{Policy: "sometimes"}
+	assert.NotNil(t, provisioning.Validate())
+}
+
+func TestBucketProvisioningCheckRegion(t *testing.T) {
+	provisioning := BucketProvisioning{Policy: BucketPolicyCreateIfMissing}
+	assert.Nil(t, provisioning.CheckRegion("cn-beijing"))
+
+	provisioning.Region = "cn-beijing"
+	assert.Nil(t, provisioning.CheckRegion("cn-beijing"))
+	err := provisioning.CheckRegion("cn-shanghai")
+	assert.True(t, errors.Is(err, ErrArgumentInvalid))
+	assert.NotNil(t, provisioning.CheckRegion(""))
+}
@@ -0,0 +1,427 @@
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+const (
+	defaultPrefix      = "cas"
+	defaultGracePeriod = time.Hour
+)
+
+// ErrContentMismatch means a blob does not hash to its name anymore
+var ErrContentMismatch = oss.NewCloudKitError("content hash mismatch", "")
+
+type Options struct {
+	// Prefix is where the blobs, the references and the counts are stored, defaults to "cas"
+	Prefix string
+	// GracePeriod protects the blobs younger than it from GC, so a blob saved
+	// just before its reference is never collected, defaults to 1h
+	GracePeriod time.Duration
+}
+
+// ref is the object stored for every logical key
+type ref struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// GCStats is the result of a garbage collection
+type GCStats struct {
+	// Blobs is the number of blobs scanned
+	Blobs int
+	// Deleted is the number of unreferenced blobs deleted
+	Deleted int
+	// FreedBytes is the size of the deleted blobs
+	FreedBytes int64
+}
+
+type locks [64]sync.Mutex
+
+// lock serializes the updates of the count of hash in this process
+func (l *locks) lock(hash string) func() {
+	b, _ := strconv.ParseUint(hash[:2], 16, 8)
+	m := &l[b%uint64(len(l))]
+	m.Lock()
+	return m.Unlock
+}
+
+// CASStorage stores every distinct content once. The blobs are named by the
+// SHA-256 of their content, every logical key is a small reference to a blob
+// and the references of every blob are counted. Unreferenced blobs are
+// removed by GC.
+//
+// Layout in the wrapped storage:
+//
+//	<prefix>/blobs/<hash[:2]>/<hash>
+//	<prefix>/refs/<key>
+//	<prefix>/counts/<hash>
+type CASStorage struct {
+	inner oss.OSS
+	opts  Options
+	locks *locks
+}
+
+func NewCASStorage(inner oss.OSS, opts Options) *CASStorage {
+	opts.Prefix = strings.Trim(opts.Prefix, "/")
+	if opts.Prefix == "" {
+		opts.Prefix = defaultPrefix
+	}
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = defaultGracePeriod
+	}
+	return &CASStorage{
+		inner: inner,
+		opts:  opts,
+		locks: &locks{},
+	}
+}
+
+func (c *CASStorage) blobKey(hash string) string {
+	return c.opts.Prefix + "/blobs/" + hash[:2] + "/" + hash
+}
+
+// refKey returns the key of the reference of key, the keys with dot segments
+// are rejected since they could address the blobs or the counts
+func (c *CASStorage) refKey(key string) (string, error) {
+	if err := oss.ValidateKey(key); err != nil {
+		return "", err
+	}
+	return c.opts.Prefix + "/refs/" + key, nil
+}
+
+func (c *CASStorage) countKey(hash string) string {
+	return c.opts.Prefix + "/counts/" + hash
+}
+
+func (c *CASStorage) loadRef(key string) (ref, error) {
+	refKey, err := c.refKey(key)
+	if err != nil {
+		return ref{}, err
+	}
+	data, err := c.inner.Load(refKey)
+	if err != nil {
+		return ref{}, err
+	}
+	r := ref{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return ref{}, err
+	}
+	if len(r.Hash) != sha256.Size*2 {
+		return ref{}, oss.ErrArgumentInvalid.Errorf("reference of %q is invalid", key)
+	}
+	return r, nil
+}
+
+func (c *CASStorage) saveRef(key string, r ref) error {
+	refKey, err := c.refKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.inner.Save(refKey, data)
+}
+
+// count returns the number of references of hash
+func (c *CASStorage) count(hash string) (int64, error) {
+	data, err := c.inner.Load(c.countKey(hash))
+	if err != nil {
+		if errclass.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+// addRef adds delta to the references of hash, it must be called with hash locked
+func (c *CASStorage) addRef(hash string, delta int64) error {
+	count, err := c.count(hash)
+	if err != nil {
+		return err
+	}
+	return c.inner.Save(c.countKey(hash), []byte(strconv.FormatInt(max(count+delta, 0), 10)))
+}
+
+// RefCount returns the number of keys referencing the blob of hash
+func (c *CASStorage) RefCount(hash string) (int64, error) {
+	return c.count(hash)
+}
+
+// Hash returns the content hash of key
+func (c *CASStorage) Hash(key string) (string, error) {
+	r, err := c.loadRef(key)
+	if err != nil {
+		return "", err
+	}
+	return r.Hash, nil
+}
+
+func (c *CASStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *c
+	storage.inner = oss.WithContext(ctx, c.inner)
+	return &storage
+}
+
+func (c *CASStorage) Unwrap() oss.OSS {
+	return c.inner
+}
+
+// Save uploads the content only if no key references it yet
+func (c *CASStorage) Save(key string, data []byte) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	previous, err := c.loadRef(key)
+	if err != nil && !errclass.IsNotFound(err) {
+		return err
+	}
+	if err == nil && previous.Hash == hash {
+		return nil
+	}
+	hadRef := err == nil
+
+	// the blob and its new reference are counted before the key points to
+	// it, so the count never falls below the number of references
+	err = func() error {
+		unlock := c.locks.lock(hash)
+		defer unlock()
+		exists, err := c.inner.Exists(c.blobKey(hash))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := c.inner.Save(c.blobKey(hash), data); err != nil {
+				return err
+			}
+		}
+		return c.addRef(hash, 1)
+	}()
+	if err != nil {
+		return err
+	}
+
+	if err := c.saveRef(key, ref{Hash: hash, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if !hadRef {
+		return nil
+	}
+	unlock := c.locks.lock(previous.Hash)
+	defer unlock()
+	return c.addRef(previous.Hash, -1)
+}
+
+// Load verifies that the content still matches its hash
+func (c *CASStorage) Load(key string) ([]byte, error) {
+	r, err := c.loadRef(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.inner.Load(c.blobKey(r.Hash))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != r.Hash {
+		return nil, ErrContentMismatch.Errorf("blob %s of %q is corrupted", r.Hash, key)
+	}
+	return data, nil
+}
+
+func (c *CASStorage) Exists(key string) (bool, error) {
+	refKey, err := c.refKey(key)
+	if err != nil {
+		return false, err
+	}
+	return c.inner.Exists(refKey)
+}
+
+// State returns the size of the content, the time the key was last saved
+// and the content hash as ETag
+func (c *CASStorage) State(key string) (oss.OSSState, error) {
+	refKey, err := c.refKey(key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	state, err := c.inner.State(refKey)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	r, err := c.loadRef(key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	return oss.OSSState{
+		Size:         r.Size,
+		LastModified: state.LastModified,
+		ETag:         r.Hash,
+	}, nil
+}
+
+func (c *CASStorage) List(prefix string) ([]oss.OSSPath, error) {
+	refKey, err := c.refKey(strings.Trim(prefix, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return c.inner.List(strings.TrimSuffix(refKey, "/"))
+}
+
+func (c *CASStorage) Delete(key string) error {
+	refKey, err := c.refKey(key)
+	if err != nil {
+		return err
+	}
+	r, err := c.loadRef(key)
+	if err != nil {
+		return err
+	}
+	if err := c.inner.Delete(refKey); err != nil {
+		return err
+	}
+	unlock := c.locks.lock(r.Hash)
+	defer unlock()
+	return c.addRef(r.Hash, -1)
+}
+
+// Copy references the content of src from dst without copying it
+func (c *CASStorage) Copy(src string, dst string) error {
+	r, err := c.loadRef(src)
+	if err != nil {
+		return err
+	}
+	previous, err := c.loadRef(dst)
+	if err != nil && !errclass.IsNotFound(err) {
+		return err
+	}
+	if err == nil && previous.Hash == r.Hash {
+		return nil
+	}
+	hadRef := err == nil
+
+	err = func() error {
+		unlock := c.locks.lock(r.Hash)
+		defer unlock()
+		return c.addRef(r.Hash, 1)
+	}()
+	if err != nil {
+		return err
+	}
+	if err := c.saveRef(dst, r); err != nil {
+		return err
+	}
+	if !hadRef {
+		return nil
+	}
+	unlock := c.locks.lock(previous.Hash)
+	defer unlock()
+	return c.addRef(previous.Hash, -1)
+}
+
+func (c *CASStorage) Type() string {
+	return c.inner.Type()
+}
+
+// GC marks the blobs referenced by the keys and deletes the blobs which are
+// neither marked nor counted and older than GracePeriod. The counts below the
+// marked references are raised. A count above them may belong to a save in
+// progress, it's lowered to the marked references once it's older than
+// GracePeriod, as the save which left it has failed.
+func (c *CASStorage) GC() (GCStats, error) {
+	refs, err := c.inner.List(c.opts.Prefix + "/refs")
+	if err != nil {
+		return GCStats{}, err
+	}
+	live := map[string]int64{}
+	for _, path := range refs {
+		if path.IsDir {
+			continue
+		}
+		r, err := c.loadRef(path.Path)
+		if err != nil {
+			if errclass.IsNotFound(err) {
+				continue
+			}
+			return GCStats{}, err
+		}
+		live[r.Hash]++
+	}
+
+	blobs, err := c.inner.List(c.opts.Prefix + "/blobs")
+	if err != nil {
+		return GCStats{}, err
+	}
+	stats := GCStats{}
+	for _, path := range blobs {
+		if path.IsDir {
+			continue
+		}
+		hash := path.Path[strings.LastIndex(path.Path, "/")+1:]
+		if len(hash) != sha256.Size*2 {
+			continue
+		}
+		stats.Blobs++
+
+		err := func() error {
+			unlock := c.locks.lock(hash)
+			defer unlock()
+
+			count, err := c.count(hash)
+			if err != nil {
+				return err
+			}
+			marked := live[hash]
+			// references added since the mark are counted but not marked
+			if count > marked {
+				state, err := c.inner.State(c.countKey(hash))
+				if err != nil {
+					return err
+				}
+				if time.Since(state.LastModified) < c.opts.GracePeriod {
+					return nil
+				}
+			}
+			if marked > 0 {
+				if count != marked {
+					return c.inner.Save(c.countKey(hash), []byte(strconv.FormatInt(marked, 10)))
+				}
+				return nil
+			}
+
+			state, err := c.inner.State(c.blobKey(hash))
+			if err != nil {
+				return err
+			}
+			if time.Since(state.LastModified) < c.opts.GracePeriod {
+				return nil
+			}
+			if err := c.inner.Delete(c.blobKey(hash)); err != nil {
+				return err
+			}
+			stats.Deleted++
+			stats.FreedBytes += state.Size
+			err = c.inner.Delete(c.countKey(hash))
+			if errclass.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}()
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,135 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func hashOf(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCASStorage(t *testing.T) {
+	inner := memory.New()
+	storage := NewCASStorage(inner, Options{})
+
+	assert.Nil(t, storage.Save("uploads/a.pdf", []byte("same")))
+	assert.Nil(t, storage.Save("uploads/b.pdf", []byte("same")))
+
+	blobs, err := inner.List("cas/blobs")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(blobs))
+	count, err := storage.RefCount(hashOf("same"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	data, err := storage.Load("uploads/b.pdf")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("same"), data)
+
+	state, err := storage.State("uploads/a.pdf")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), state.Size)
+	assert.Equal(t, hashOf("same"), state.ETag)
+
+	paths, err := storage.List("uploads")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pdf"}, {Path: "b.pdf"}}, paths)
+
+	// overwriting moves the reference to the new content
+	assert.Nil(t, storage.Save("uploads/a.pdf", []byte("other")))
+	count, _ = storage.RefCount(hashOf("same"))
+	assert.Equal(t, int64(1), count)
+	count, _ = storage.RefCount(hashOf("other"))
+	assert.Equal(t, int64(1), count)
+
+	assert.Nil(t, oss.Copy(storage, "uploads/a.pdf", "uploads/c.pdf"))
+	count, _ = storage.RefCount(hashOf("other"))
+	assert.Equal(t, int64(2), count)
+
+	assert.Nil(t, storage.Delete("uploads/b.pdf"))
+	exists, err := storage.Exists("uploads/b.pdf")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	count, _ = storage.RefCount(hashOf("same"))
+	assert.Equal(t, int64(0), count)
+
+	// a key with dot segments could overwrite a count or a blob
+	err = storage.Save("../counts/"+hashOf("other"), []byte("0"))
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	_, err = storage.Load("../blobs/x")
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	count, _ = storage.RefCount(hashOf("other"))
+	assert.Equal(t, int64(2), count)
+}
+
+func TestCASGarbageCollection(t *testing.T) {
+	inner := memory.New()
+	storage := NewCASStorage(inner, Options{GracePeriod: time.Hour})
+
+	assert.Nil(t, storage.Save("a", []byte("kept")))
+	assert.Nil(t, storage.Save("b", []byte("dropped")))
+	assert.Nil(t, storage.Delete("b"))
+
+	// the unreferenced blob is still in its grace period
+	stats, err := storage.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, GCStats{Blobs: 2}, stats)
+
+	storage.opts.GracePeriod = time.Nanosecond
+	stats, err = storage.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, GCStats{Blobs: 2, Deleted: 1, FreedBytes: 7}, stats)
+
+	exists, _ := inner.Exists(storage.blobKey(hashOf("dropped")))
+	assert.False(t, exists)
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("kept"), data)
+
+	// a corrupted blob is detected
+	assert.Nil(t, inner.Save(storage.blobKey(hashOf("kept")), []byte("changed")))
+	_, err = storage.Load("a")
+	assert.True(t, errors.Is(err, ErrContentMismatch))
+	assert.Contains(t, err.Error(), `"a"`)
+	// the detail is not written to the shared error
+	assert.Equal(t, "", ErrContentMismatch.Detail)
+}
+
+func TestCASGarbageCollectionReconcilesCounts(t *testing.T) {
+	inner := memory.New()
+	storage := NewCASStorage(inner, Options{GracePeriod: time.Hour})
+
+	assert.Nil(t, storage.Save("a", []byte("shared")))
+	assert.Nil(t, storage.Save("b", []byte("orphan")))
+	// saves whose reference failed after the count was raised
+	assert.Nil(t, storage.addRef(hashOf("shared"), 1))
+	assert.Nil(t, inner.Delete(storage.opts.Prefix+"/refs/b"))
+
+	// the counts may still belong to saves in progress
+	stats, err := storage.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, GCStats{Blobs: 2}, stats)
+	count, _ := storage.RefCount(hashOf("shared"))
+	assert.Equal(t, int64(2), count)
+
+	storage.opts.GracePeriod = time.Nanosecond
+	stats, err = storage.GC()
+	assert.Nil(t, err)
+	assert.Equal(t, GCStats{Blobs: 2, Deleted: 1, FreedBytes: 6}, stats)
+	count, _ = storage.RefCount(hashOf("shared"))
+	assert.Equal(t, int64(1), count)
+	exists, _ := inner.Exists(storage.blobKey(hashOf("orphan")))
+	assert.False(t, exists)
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("shared"), data)
+}
@@ -0,0 +1,270 @@
+package chaos
+
+import (
+	"context"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+// InjectedError is returned for the injected failures, it's classified by
+// errclass like the error of a provider with the same status code
+type InjectedError struct {
+	Message    string
+	StatusCode int
+	Cause      error
+}
+
+func (e *InjectedError) Error() string {
+	return "chaos: " + e.Message
+}
+
+func (e *InjectedError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+func (e *InjectedError) Unwrap() error {
+	return e.Cause
+}
+
+// errclass classifies them as NotFound, Throttled, Unavailable and Timeout
+var (
+	ErrNotFound    = &InjectedError{Message: "object not found", StatusCode: http.StatusNotFound, Cause: fs.ErrNotExist}
+	ErrThrottled   = &InjectedError{Message: "too many requests", StatusCode: http.StatusTooManyRequests}
+	ErrUnavailable = &InjectedError{Message: "internal error", StatusCode: http.StatusInternalServerError}
+	ErrTimeout     = &InjectedError{Message: "request timeout", Cause: context.DeadlineExceeded}
+)
+
+// Rule injects a fault into the matching operations
+type Rule struct {
+	// Operations are the operations the rule applies to, all of them if empty
+	Operations []oss.Operation
+	// Keys matches the keys the rule applies to, all of them if nil
+	Keys *regexp.Regexp
+	// Probability is the chance of a matching operation to fail, zero means always
+	Probability float64
+
+	// Latency delays the operation
+	Latency time.Duration
+	// Err is returned instead of calling the storage
+	Err error
+	// Truncate returns only this ratio of the loaded data, with Err if set,
+	// it must be between 0 and 1
+	Truncate float64
+	// PartialWrite saves only this ratio of the data and returns Err, or
+	// ErrUnavailable if Err is not set, it must be between 0 and 1
+	PartialWrite float64
+}
+
+func (r *Rule) validate() error {
+	if r.Truncate < 0 || r.Truncate > 1 {
+		return oss.ErrArgumentInvalid.Errorf("truncate ratio %v must be between 0 and 1", r.Truncate)
+	}
+	if r.PartialWrite < 0 || r.PartialWrite > 1 {
+		return oss.ErrArgumentInvalid.Errorf("partial write ratio %v must be between 0 and 1", r.PartialWrite)
+	}
+	return nil
+}
+
+func (r *Rule) matches(op oss.Operation, key string) bool {
+	if len(r.Operations) > 0 && !slices.Contains(r.Operations, op) {
+		return false
+	}
+	return r.Keys == nil || r.Keys.MatchString(key)
+}
+
+type Options struct {
+	// Rules are checked in order, the first matching rule which fires is applied
+	Rules []Rule
+	// Seed makes the sequence of faults reproducible
+	Seed int64
+}
+
+type state struct {
+	enabled  atomic.Bool
+	injected atomic.Uint64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// ChaosStorage injects errors, latency, truncated reads and partial writes
+// into the operations of a storage, it's meant for resilience tests
+type ChaosStorage struct {
+	inner oss.OSS
+	rules []Rule
+	ctx   context.Context
+	state *state
+}
+
+func NewChaosStorage(inner oss.OSS, opts Options) (*ChaosStorage, error) {
+	for i := range opts.Rules {
+		if err := opts.Rules[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	s := &state{rand: rand.New(rand.NewSource(opts.Seed))}
+	s.enabled.Store(true)
+	return &ChaosStorage{
+		inner: inner,
+		rules: opts.Rules,
+		ctx:   context.Background(),
+		state: s,
+	}, nil
+}
+
+// SetEnabled turns the injection on or off
+func (c *ChaosStorage) SetEnabled(enabled bool) {
+	c.state.enabled.Store(enabled)
+}
+
+// Injected returns the number of faults injected
+func (c *ChaosStorage) Injected() uint64 {
+	return c.state.injected.Load()
+}
+
+// fault returns the rule to apply to the operation, nil if none fires
+func (c *ChaosStorage) fault(op oss.Operation, key string) *Rule {
+	if !c.state.enabled.Load() {
+		return nil
+	}
+	for i := range c.rules {
+		rule := &c.rules[i]
+		if !rule.matches(op, key) {
+			continue
+		}
+		if rule.Probability > 0 {
+			c.state.mu.Lock()
+			roll := c.state.rand.Float64()
+			c.state.mu.Unlock()
+			if roll >= rule.Probability {
+				continue
+			}
+		}
+		c.state.injected.Add(1)
+		return rule
+	}
+	return nil
+}
+
+// delay waits for the latency of the rule, it stops when the context is done
+func (c *ChaosStorage) delay(rule *Rule) error {
+	if rule.Latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(rule.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+func (c *ChaosStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *c
+	storage.ctx = ctx
+	storage.inner = oss.WithContext(ctx, c.inner)
+	return &storage
+}
+
+func (c *ChaosStorage) Unwrap() oss.OSS {
+	return c.inner
+}
+
+func (c *ChaosStorage) Save(key string, data []byte) error {
+	rule := c.fault(oss.OperationSave, key)
+	if rule == nil {
+		return c.inner.Save(key, data)
+	}
+	if err := c.delay(rule); err != nil {
+		return err
+	}
+	if rule.PartialWrite > 0 {
+		if err := c.inner.Save(key, data[:int(float64(len(data))*rule.PartialWrite)]); err != nil {
+			return err
+		}
+		if rule.Err == nil {
+			return ErrUnavailable
+		}
+		return rule.Err
+	}
+	if rule.Err != nil {
+		return rule.Err
+	}
+	return c.inner.Save(key, data)
+}
+
+func (c *ChaosStorage) Load(key string) ([]byte, error) {
+	rule := c.fault(oss.OperationLoad, key)
+	if rule == nil {
+		return c.inner.Load(key)
+	}
+	if err := c.delay(rule); err != nil {
+		return nil, err
+	}
+	if rule.Truncate > 0 {
+		data, err := c.inner.Load(key)
+		if err != nil {
+			return nil, err
+		}
+		return data[:int(float64(len(data))*rule.Truncate)], rule.Err
+	}
+	if rule.Err != nil {
+		return nil, rule.Err
+	}
+	return c.inner.Load(key)
+}
+
+func (c *ChaosStorage) Exists(key string) (bool, error) {
+	if err := c.inject(oss.OperationExists, key); err != nil {
+		return false, err
+	}
+	return c.inner.Exists(key)
+}
+
+func (c *ChaosStorage) State(key string) (oss.OSSState, error) {
+	if err := c.inject(oss.OperationState, key); err != nil {
+		return oss.OSSState{}, err
+	}
+	return c.inner.State(key)
+}
+
+func (c *ChaosStorage) List(prefix string) ([]oss.OSSPath, error) {
+	if err := c.inject(oss.OperationList, prefix); err != nil {
+		return nil, err
+	}
+	return c.inner.List(prefix)
+}
+
+func (c *ChaosStorage) Delete(key string) error {
+	if err := c.inject(oss.OperationDelete, key); err != nil {
+		return err
+	}
+	return c.inner.Delete(key)
+}
+
+func (c *ChaosStorage) Type() string {
+	return c.inner.Type()
+}
+
+// inject applies the latency and the error of a rule to an operation which
+// can't be truncated
+func (c *ChaosStorage) inject(op oss.Operation, key string) error {
+	rule := c.fault(op, key)
+	if rule == nil {
+		return nil
+	}
+	if err := c.delay(rule); err != nil {
+		return err
+	}
+	return rule.Err
+}
@@ -0,0 +1,90 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChaosRules(t *testing.T) {
+	inner := memory.New()
+	assert.Nil(t, inner.Save("plugins/a.pkg", []byte("0123456789")))
+
+	storage, err := NewChaosStorage(inner, Options{Rules: []Rule{
+		{Operations: []oss.Operation{oss.OperationExists}, Err: ErrNotFound},
+		{Operations: []oss.Operation{oss.OperationLoad}, Keys: regexp.MustCompile(`\.pkg$`), Truncate: 0.5},
+		{Operations: []oss.Operation{oss.OperationSave}, PartialWrite: 0.3},
+		{Operations: []oss.Operation{oss.OperationDelete}, Err: ErrThrottled},
+		{Operations: []oss.Operation{oss.OperationList}, Latency: time.Second},
+	}})
+	assert.Nil(t, err)
+
+	_, err = storage.Exists("plugins/a.pkg")
+	assert.Equal(t, errclass.NotFound, errclass.Classify(err))
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("01234"), data)
+
+	err = storage.Save("plugins/b.pkg", []byte("0123456789"))
+	assert.Equal(t, errclass.Unavailable, errclass.Classify(err))
+	data, _ = inner.Load("plugins/b.pkg")
+	assert.Equal(t, []byte("012"), data)
+
+	err = storage.Delete("plugins/a.pkg")
+	assert.Equal(t, errclass.Throttled, errclass.Classify(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = storage.WithContext(ctx).List("plugins")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, uint64(5), storage.Injected())
+
+	storage.SetEnabled(false)
+	_, err = storage.List("plugins")
+	assert.Nil(t, err)
+}
+
+func TestChaosSeed(t *testing.T) {
+	inner := memory.New()
+	run := func() []bool {
+		storage, err := NewChaosStorage(inner, Options{
+			Rules: []Rule{{Probability: 0.5, Err: ErrTimeout}},
+			Seed:  42,
+		})
+		assert.Nil(t, err)
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := storage.Exists("a")
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first := run()
+	assert.Equal(t, first, run())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestChaosRatioOutOfRange(t *testing.T) {
+	inner := memory.New()
+	for _, rule := range []Rule{{Truncate: 1.5}, {PartialWrite: 2}, {Truncate: -0.1}} {
+		_, err := NewChaosStorage(inner, Options{Rules: []Rule{rule}})
+		assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	}
+
+	storage, err := NewChaosStorage(inner, Options{Rules: []Rule{{Truncate: 1}}})
+	assert.Nil(t, err)
+	assert.Nil(t, inner.Save("a", []byte("0123")))
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("0123"), data)
+}
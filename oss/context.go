@@ -0,0 +1,25 @@
+package oss
+
+import "context"
+
+// ContextBinder is implemented by the storages which are able to run their
+// requests under a context supplied by the caller
+type ContextBinder interface {
+	// WithContext returns a copy of the storage whose operations use ctx
+	WithContext(ctx context.Context) OSS
+}
+
+// Wrapper is implemented by the storages which decorate another storage
+type Wrapper interface {
+	// Unwrap returns the decorated storage
+	Unwrap() OSS
+}
+
+// WithContext binds ctx to the storage, the storage is returned as it is
+// when it does not support contexts
+func WithContext(ctx context.Context, storage OSS) OSS {
+	if binder, ok := storage.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return storage
+}
@@ -0,0 +1,22 @@
+package oss
+
+// Copier is implemented by the storages which copy an object without the
+// caller downloading and uploading it
+type Copier interface {
+	// Copy copies the object src to dst, dst is overwritten if it exists
+	Copy(src string, dst string) error
+}
+
+// Copy copies the object src to dst, through Copier if the storage implements
+// it, otherwise by loading and saving it. The fallback holds the whole object
+// in memory, so it's meant for the objects which fit in memory.
+func Copy(storage OSS, src string, dst string) error {
+	if copier, ok := storage.(Copier); ok {
+		return copier.Copy(src, dst)
+	}
+	data, err := storage.Load(src)
+	if err != nil {
+		return err
+	}
+	return storage.Save(dst, data)
+}
@@ -0,0 +1,508 @@
+package diskcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+const (
+	dataSuffix = ".data"
+	metaSuffix = ".meta"
+	tmpSuffix  = ".tmp"
+
+	defaultMaxBytes = 1 << 30
+)
+
+type Options struct {
+	// Dir stores the cached objects, it's indexed again when the cache is created
+	Dir string
+	// MaxBytes bounds the total size of the cached objects, defaults to 1GiB
+	MaxBytes int64
+	// TTL is how long a cached object is served without comparing it with
+	// the State of the storage, it's compared on every Load if TTL is zero
+	TTL time.Duration
+}
+
+// entry is persisted next to the cached data as <name>.meta
+type entry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag"`
+	ValidatedAt  time.Time `json:"validated_at"`
+
+	name    string
+	element *list.Element
+}
+
+func (e *entry) matches(state oss.OSSState) bool {
+	if e.ETag != "" && state.ETag != "" {
+		return e.ETag == state.ETag && e.Size == state.Size
+	}
+	return e.Size == state.Size && e.LastModified.Equal(state.LastModified)
+}
+
+// fetch counts the loads of a key missing from the cache, generation changes
+// on every invalidation of the key
+type fetch struct {
+	calls      int
+	generation uint64
+}
+
+// cache does the file I/O outside of mu, which only guards the index. Every
+// put writes the files of a new name, so the files of an entry are never
+// rewritten while they're read and a replaced entry's files are removed
+// once it left the index.
+type cache struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// lru holds the entries from the most to the least recently used
+	lru  *list.List
+	size int64
+	// fetches are the keys being loaded, a load invalidated in the meantime
+	// is not cached
+	fetches map[string]*fetch
+}
+
+// DiskCacheStorage caches the results of Load on the local disk, the cached
+// objects are evicted by LRU once MaxBytes is exceeded. Save and Delete
+// through the wrapper invalidate the cached object.
+type DiskCacheStorage struct {
+	inner oss.OSS
+	cache *cache
+}
+
+func NewDiskCacheStorage(inner oss.OSS, opts Options) (*DiskCacheStorage, error) {
+	if opts.Dir == "" {
+		return nil, oss.ErrArgumentInvalid.WithDetail("dir cannot be empty")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, oss.ErrProviderInit.WithError(err).WithDetail("failed to create cache dir")
+	}
+
+	c := &cache{
+		dir:      opts.Dir,
+		maxBytes: opts.MaxBytes,
+		ttl:      opts.TTL,
+		entries:  map[string]*entry{},
+		lru:      list.New(),
+		fetches:  map[string]*fetch{},
+	}
+	if err := c.index(); err != nil {
+		return nil, oss.ErrProviderInit.WithError(err).WithDetail("failed to index cache dir")
+	}
+
+	return &DiskCacheStorage{
+		inner: inner,
+		cache: c,
+	}, nil
+}
+
+// index loads the entries left by a previous process, the data files are
+// touched on every hit so their modification time orders the LRU
+func (c *cache) index() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type indexed struct {
+		entry  *entry
+		usedAt time.Time
+	}
+	var found []indexed
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, tmpSuffix) {
+			os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, metaSuffix) {
+			continue
+		}
+
+		name = strings.TrimSuffix(name, metaSuffix)
+		e, usedAt, err := c.readEntry(name)
+		if err != nil {
+			// an incomplete entry is dropped
+			c.removeFiles(name)
+			continue
+		}
+		found = append(found, indexed{entry: e, usedAt: usedAt})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].usedAt.After(found[j].usedAt)
+	})
+	for _, f := range found {
+		// a key left twice by a crash keeps its most recently used entry
+		if _, ok := c.entries[f.entry.Key]; ok {
+			c.removeFiles(f.entry.name)
+			continue
+		}
+		f.entry.element = c.lru.PushBack(f.entry)
+		c.entries[f.entry.Key] = f.entry
+		c.size += f.entry.Size
+	}
+	c.removeEntries(c.evictLocked())
+
+	// data files without metadata are never served
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, dataSuffix) {
+			if _, err := os.Stat(filepath.Join(c.dir, strings.TrimSuffix(name, dataSuffix)+metaSuffix)); err != nil {
+				os.Remove(filepath.Join(c.dir, name))
+			}
+		}
+	}
+	return nil
+}
+
+func (c *cache) readEntry(name string) (*entry, time.Time, error) {
+	raw, err := os.ReadFile(filepath.Join(c.dir, name+metaSuffix))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	e := &entry{}
+	if err := json.Unmarshal(raw, e); err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(filepath.Join(c.dir, name+dataSuffix))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if info.Size() != e.Size || !strings.HasPrefix(name, entryName(e.Key)) {
+		return nil, time.Time{}, os.ErrInvalid
+	}
+	e.name = name
+	return e, info.ModTime(), nil
+}
+
+func entryName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newEntryName returns a name for the files of a new entry of key
+func newEntryName(key string) (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return entryName(key) + "-" + hex.EncodeToString(suffix), nil
+}
+
+func (c *cache) removeFiles(name string) {
+	os.Remove(filepath.Join(c.dir, name+dataSuffix))
+	os.Remove(filepath.Join(c.dir, name+metaSuffix))
+}
+
+// writeFile replaces the file atomically
+func (c *cache) writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(c.dir, name+"-*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// lookup returns a copy of the entry of key and marks it as recently used
+func (c *cache) lookup(key string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return entry{}, false
+	}
+	c.lru.MoveToFront(e.element)
+	return *e, true
+}
+
+// begin registers a load of key and returns the generation of the key,
+// finish must be called once the result is cached
+func (c *cache) begin(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.fetches[key]
+	if !ok {
+		f = &fetch{}
+		c.fetches[key] = f
+	}
+	f.calls++
+	return f.generation
+}
+
+func (c *cache) finish(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.fetches[key]
+	f.calls--
+	if f.calls == 0 {
+		delete(c.fetches, key)
+	}
+}
+
+// currentLocked reports whether key was not invalidated since the load began
+func (c *cache) currentLocked(key string, generation uint64) bool {
+	f, ok := c.fetches[key]
+	return ok && f.generation == generation
+}
+
+// put caches the data loaded at generation, it's dropped if the key was
+// invalidated in the meantime
+func (c *cache) put(key string, data []byte, state oss.OSSState, generation uint64) {
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return
+	}
+
+	name, err := newEntryName(key)
+	if err != nil {
+		return
+	}
+	e := &entry{
+		Key:          key,
+		Size:         size,
+		LastModified: state.LastModified,
+		ETag:         state.ETag,
+		ValidatedAt:  time.Now(),
+		name:         name,
+	}
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	// the data is written before the metadata, so a crash never leaves a valid entry with partial data
+	if c.writeFile(e.name+dataSuffix, data) != nil || c.writeFile(e.name+metaSuffix, meta) != nil {
+		c.removeFiles(e.name)
+		return
+	}
+
+	c.mu.Lock()
+	if !c.currentLocked(key, generation) {
+		c.mu.Unlock()
+		c.removeFiles(e.name)
+		return
+	}
+	var removed []*entry
+	if old := c.detachLocked(key); old != nil {
+		removed = append(removed, old)
+	}
+	e.element = c.lru.PushFront(e)
+	c.entries[key] = e
+	c.size += size
+	removed = append(removed, c.evictLocked()...)
+	c.mu.Unlock()
+
+	c.removeEntries(removed)
+}
+
+// validated records that the entry named name still matches the storage
+func (c *cache) validated(key string, name string) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok || e.name != name {
+		c.mu.Unlock()
+		return
+	}
+	e.ValidatedAt = time.Now()
+	meta, err := json.Marshal(e)
+	c.mu.Unlock()
+
+	if err != nil || c.writeFile(name+metaSuffix, meta) != nil {
+		return
+	}
+	// the metadata written after a concurrent removal is removed again
+	c.mu.Lock()
+	e, ok = c.entries[key]
+	removed := !ok || e.name != name
+	c.mu.Unlock()
+	if removed {
+		c.removeFiles(name)
+	}
+}
+
+// remove invalidates key, the loads in progress are not cached
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	if f, ok := c.fetches[key]; ok {
+		f.generation++
+	}
+	e := c.detachLocked(key)
+	c.mu.Unlock()
+	if e != nil {
+		c.removeFiles(e.name)
+	}
+}
+
+// removeEntry removes the entry of key only if it is still the one named name
+func (c *cache) removeEntry(key string, name string) {
+	c.mu.Lock()
+	var e *entry
+	if current, ok := c.entries[key]; ok && current.name == name {
+		e = c.detachLocked(key)
+	}
+	c.mu.Unlock()
+	if e != nil {
+		c.removeFiles(e.name)
+	}
+}
+
+func (c *cache) removeEntries(entries []*entry) {
+	for _, e := range entries {
+		c.removeFiles(e.name)
+	}
+}
+
+// detachLocked removes the entry of key from the index, the caller removes its files
+func (c *cache) detachLocked(key string) *entry {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.Remove(e.element)
+	delete(c.entries, key)
+	c.size -= e.Size
+	return e
+}
+
+// evictLocked detaches the least recently used entries until the cache fits in
+// maxBytes, the caller removes their files
+func (c *cache) evictLocked() []*entry {
+	var evicted []*entry
+	for c.size > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		evicted = append(evicted, c.detachLocked(oldest.Value.(*entry).Key))
+	}
+	return evicted
+}
+
+// read returns the cached data and refreshes the modification time of the data file
+func (c *cache) read(e entry) ([]byte, bool) {
+	path := filepath.Join(c.dir, e.name+dataSuffix)
+	data, err := os.ReadFile(path)
+	if err != nil || int64(len(data)) != e.Size {
+		c.removeEntry(e.Key, e.name)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+func (d *DiskCacheStorage) WithContext(ctx context.Context) oss.OSS {
+	return &DiskCacheStorage{
+		inner: oss.WithContext(ctx, d.inner),
+		cache: d.cache,
+	}
+}
+
+func (d *DiskCacheStorage) Unwrap() oss.OSS {
+	return d.inner
+}
+
+// Size returns the total size of the cached objects
+func (d *DiskCacheStorage) Size() int64 {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	return d.cache.size
+}
+
+func (d *DiskCacheStorage) Load(key string) ([]byte, error) {
+	if e, ok := d.cache.lookup(key); ok {
+		if d.cache.ttl > 0 && time.Since(e.ValidatedAt) < d.cache.ttl {
+			if data, ok := d.cache.read(e); ok {
+				return data, nil
+			}
+		} else {
+			state, err := d.inner.State(key)
+			if err != nil {
+				if errclass.IsNotFound(err) {
+					d.cache.remove(key)
+				}
+				return nil, err
+			}
+			if e.matches(state) {
+				if data, ok := d.cache.read(e); ok {
+					d.cache.validated(key, e.name)
+					return data, nil
+				}
+			}
+			d.cache.removeEntry(key, e.name)
+		}
+	}
+
+	generation := d.cache.begin(key)
+	defer d.cache.finish(key)
+	// the state is taken before the data, if the object changes in between
+	// the cached state is stale and the next validation loads it again
+	state, err := d.inner.State(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.inner.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	d.cache.put(key, data, state, generation)
+	return data, nil
+}
+
+func (d *DiskCacheStorage) Save(key string, data []byte) error {
+	defer d.cache.remove(key)
+	return d.inner.Save(key, data)
+}
+
+func (d *DiskCacheStorage) Delete(key string) error {
+	defer d.cache.remove(key)
+	return d.inner.Delete(key)
+}
+
+func (d *DiskCacheStorage) Exists(key string) (bool, error) {
+	return d.inner.Exists(key)
+}
+
+func (d *DiskCacheStorage) State(key string) (oss.OSSState, error) {
+	return d.inner.State(key)
+}
+
+func (d *DiskCacheStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return d.inner.List(prefix)
+}
+
+func (d *DiskCacheStorage) Type() string {
+	return d.inner.Type()
+}
@@ -0,0 +1,180 @@
+package diskcache
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStorage counts the loads reaching the storage, afterLoad is called
+// once the data is loaded
+type countingStorage struct {
+	oss.OSS
+	loads     int
+	afterLoad func()
+}
+
+func (c *countingStorage) Load(key string) ([]byte, error) {
+	c.loads++
+	data, err := c.OSS.Load(key)
+	if c.afterLoad != nil {
+		c.afterLoad()
+	}
+	return data, err
+}
+
+func newCountingStorage(t *testing.T) *countingStorage {
+	storage, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	return &countingStorage{OSS: storage}
+}
+
+func TestDiskCacheLoad(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("plugins/a.pkg", []byte("package-a")))
+
+	storage, err := NewDiskCacheStorage(inner, Options{Dir: t.TempDir(), TTL: time.Hour})
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		data, err := storage.Load("plugins/a.pkg")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("package-a"), data)
+	}
+	assert.Equal(t, 1, inner.loads)
+	assert.Equal(t, int64(9), storage.Size())
+
+	// saving through the wrapper invalidates the cached object
+	assert.Nil(t, storage.Save("plugins/a.pkg", []byte("package-b")))
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("package-b"), data)
+	assert.Equal(t, 2, inner.loads)
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	_, err = storage.Load("plugins/a.pkg")
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), storage.Size())
+}
+
+func TestDiskCacheValidatesState(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("a", []byte("one")))
+
+	storage, err := NewDiskCacheStorage(inner, Options{Dir: t.TempDir()})
+	assert.Nil(t, err)
+
+	_, err = storage.Load("a")
+	assert.Nil(t, err)
+	_, err = storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, inner.loads)
+
+	// the object is changed behind the cache
+	assert.Nil(t, inner.Save("a", []byte("three")))
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("three"), data)
+	assert.Equal(t, 2, inner.loads)
+}
+
+func TestDiskCacheLoadRacingSave(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("a", []byte("old")))
+	storage, err := NewDiskCacheStorage(inner, Options{Dir: t.TempDir(), TTL: time.Hour})
+	assert.Nil(t, err)
+
+	// the save lands between the load of the old data and its caching
+	inner.afterLoad = func() {
+		inner.afterLoad = nil
+		assert.Nil(t, storage.Save("a", []byte("new")))
+	}
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), data)
+	assert.Equal(t, int64(0), storage.Size())
+
+	data, err = storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), data)
+	entries, _ := os.ReadDir(storage.cache.dir)
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestDiskCacheEvictsAndSurvivesRestart(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("a", make([]byte, 40)))
+	assert.Nil(t, inner.Save("b", make([]byte, 40)))
+	assert.Nil(t, inner.Save("c", make([]byte, 40)))
+
+	dir := t.TempDir()
+	storage, err := NewDiskCacheStorage(inner, Options{Dir: dir, MaxBytes: 100, TTL: time.Hour})
+	assert.Nil(t, err)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := storage.Load(key)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int64(80), storage.Size())
+
+	restarted, err := NewDiskCacheStorage(inner, Options{Dir: dir, MaxBytes: 100, TTL: time.Hour})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(80), restarted.Size())
+
+	inner.loads = 0
+	_, err = restarted.Load("b")
+	assert.Nil(t, err)
+	_, err = restarted.Load("c")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, inner.loads)
+
+	// a was evicted before the restart
+	_, err = restarted.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, inner.loads)
+}
+
+func TestDiskCacheConcurrentLoads(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	keys := []string{"a", "b", "c", "d"}
+	for _, key := range keys {
+		assert.Nil(t, inner.Save(key, []byte(strings.Repeat(key, 30))))
+	}
+
+	dir := t.TempDir()
+	storage, err := NewDiskCacheStorage(inner, Options{Dir: dir, MaxBytes: 100})
+	assert.Nil(t, err)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := keys[(i+j)%len(keys)]
+				// invalidations race with the reads of the same entry
+				if j%10 == 0 {
+					storage.cache.remove(key)
+					continue
+				}
+				data, err := storage.Load(key)
+				assert.Nil(t, err)
+				assert.Equal(t, []byte(strings.Repeat(key, 30)), data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// only the files of the indexed entries are left
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*len(storage.cache.entries), len(files))
+	assert.LessOrEqual(t, storage.Size(), int64(100))
+}
@@ -0,0 +1,207 @@
+package errclass
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	aliyun "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/smithy-go"
+	"github.com/baidubce/bce-sdk-go/bce"
+	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/ncw/swift/v2"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"github.com/volcengine/ve-tos-golang-sdk/v2/tos"
+	"google.golang.org/api/googleapi"
+)
+
+// Class groups the errors of all the providers by their cause
+type Class string
+
+const (
+	None        Class = ""
+	NotFound    Class = "not_found"
+	Throttled   Class = "throttled"
+	Unavailable Class = "unavailable"
+	Timeout     Class = "timeout"
+	Canceled    Class = "canceled"
+	Permission  Class = "permission"
+	Invalid     Class = "invalid"
+	Unknown     Class = "unknown"
+)
+
+// Retryable reports whether another attempt may succeed
+func (c Class) Retryable() bool {
+	return c == Throttled || c == Unavailable || c == Timeout
+}
+
+// codes are the error codes of the providers which tell more than the status code
+var codes = map[string]Class{
+	// aws s3 and the s3 compatible providers
+	"NoSuchKey":             NotFound,
+	"NoSuchBucket":          NotFound,
+	"NotFound":              NotFound,
+	"SlowDown":              Throttled,
+	"Throttling":            Throttled,
+	"ThrottlingException":   Throttled,
+	"RequestLimitExceeded":  Throttled,
+	"TooManyRequests":       Throttled,
+	"RequestTimeout":        Timeout,
+	"InternalError":         Unavailable,
+	"ServiceUnavailable":    Unavailable,
+	"AccessDenied":          Permission,
+	"InvalidAccessKeyId":    Permission,
+	"SignatureDoesNotMatch": Permission,
+	// azure blob
+	"BlobNotFound":                   NotFound,
+	"ContainerNotFound":              NotFound,
+	"ServerBusy":                     Throttled,
+	"OperationTimedOut":              Timeout,
+	"AuthorizationFailure":           Permission,
+	"AuthenticationFailed":           Permission,
+	"InsufficientAccountPermissions": Permission,
+	// tencent cos
+	"ServiceUnavailableException": Throttled,
+	"KeyTooLongError":             Invalid,
+	// volcengine tos and huawei obs
+	"ExceedAccountQPSLimit":    Throttled,
+	"ExceedBucketQPSLimit":     Throttled,
+	"ExceedAccountRateLimit":   Throttled,
+	"ExceedBucketRateLimit":    Throttled,
+	"TooManyRequestsException": Throttled,
+	// baidu bos
+	"RequestRateLimitExceeded": Throttled,
+	// oci object storage
+	"ObjectNotFound":   NotFound,
+	"BucketNotFound":   NotFound,
+	"NotAuthenticated": Permission,
+}
+
+// Classify returns the class of err, None is returned for nil
+func Classify(err error) Class {
+	if err == nil {
+		return None
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, fs.ErrNotExist),
+		errors.Is(err, storage.ErrObjectNotExist),
+		errors.Is(err, storage.ErrBucketNotExist):
+		return NotFound
+	case errors.Is(err, fs.ErrPermission):
+		return Permission
+	case errors.Is(err, oss.ErrCircuitOpen):
+		return Unavailable
+	}
+
+	code, status := Code(err)
+	if class, ok := codes[code]; ok {
+		return class
+	}
+	if status != 0 {
+		return fromStatus(status)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Timeout
+	}
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return Unavailable
+	}
+	return Unknown
+}
+
+// IsNotFound reports whether err means the object or the bucket does not exist
+func IsNotFound(err error) bool {
+	return Classify(err) == NotFound
+}
+
+// Code extracts the error code and the http status from the error of a provider,
+// the status is 0 if the error has no response
+func Code(err error) (string, int) {
+	var (
+		awsErr    smithy.APIError
+		azureErr  *azcore.ResponseError
+		googleErr *googleapi.Error
+		aliyunErr aliyun.ServiceError
+		cosErr    *cos.ErrorResponse
+		obsErr    obs.ObsError
+		tosErr    *tos.TosServerError
+		bceErr    *bce.BceServiceError
+		ociErr    common.ServiceError
+		swiftErr  *swift.Error
+		statusErr interface{ HTTPStatusCode() int }
+	)
+
+	code := ""
+	status := 0
+	switch {
+	case errors.As(err, &azureErr):
+		code, status = azureErr.ErrorCode, azureErr.StatusCode
+	case errors.As(err, &googleErr):
+		status = googleErr.Code
+		if len(googleErr.Errors) > 0 {
+			code = googleErr.Errors[0].Reason
+		}
+	case errors.As(err, &aliyunErr):
+		code, status = aliyunErr.Code, aliyunErr.StatusCode
+	case errors.As(err, &cosErr):
+		code = cosErr.Code
+		if cosErr.Response != nil {
+			status = cosErr.Response.StatusCode
+		}
+	case errors.As(err, &obsErr):
+		code, status = obsErr.Code, obsErr.StatusCode
+	case errors.As(err, &tosErr):
+		code, status = tosErr.Code, tosErr.StatusCode
+	case errors.As(err, &bceErr):
+		code, status = bceErr.Code, bceErr.StatusCode
+	case errors.As(err, &ociErr):
+		code, status = ociErr.GetCode(), ociErr.GetHTTPStatusCode()
+	case errors.As(err, &swiftErr):
+		status = swiftErr.StatusCode
+	case errors.As(err, &awsErr):
+		code = awsErr.ErrorCode()
+	}
+
+	// the errors of aws and of the in-process stand-ins carry the status this way
+	if status == 0 && errors.As(err, &statusErr) {
+		status = statusErr.HTTPStatusCode()
+	}
+	return code, status
+}
+
+func fromStatus(status int) Class {
+	switch {
+	case status == http.StatusNotFound:
+		return NotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return Permission
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return Timeout
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return Throttled
+	case status >= 500:
+		return Unavailable
+	case status >= 400:
+		return Invalid
+	default:
+		return Unknown
+	}
+}
@@ -0,0 +1,47 @@
+package errclass
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	aliyun "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/smithy-go"
+	"github.com/baidubce/bce-sdk-go/bce"
+	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/ncw/swift/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"github.com/volcengine/ve-tos-golang-sdk/v2/tos"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err   error
+		class Class
+	}{
+		{err: nil, class: None},
+		{err: context.Canceled, class: Canceled},
+		{err: fmt.Errorf("load: %w", context.DeadlineExceeded), class: Timeout},
+		{err: &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist}, class: NotFound},
+		{err: &smithy.GenericAPIError{Code: "SlowDown"}, class: Throttled},
+		{err: &smithy.GenericAPIError{Code: "NoSuchKey"}, class: NotFound},
+		{err: &azcore.ResponseError{ErrorCode: "ServerBusy", StatusCode: 503}, class: Throttled},
+		{err: aliyun.ServiceError{Code: "InternalError", StatusCode: 500}, class: Unavailable},
+		{err: &cos.ErrorResponse{Response: &http.Response{StatusCode: 503}}, class: Throttled},
+		{err: obs.ObsError{BaseModel: obs.BaseModel{StatusCode: 404}}, class: NotFound},
+		{err: &tos.TosServerError{RequestInfo: tos.RequestInfo{StatusCode: 403}}, class: Permission},
+		{err: &bce.BceServiceError{Code: "NoSuchKey", StatusCode: 404}, class: NotFound},
+		{err: swift.ObjectNotFound, class: NotFound},
+		{err: swift.Forbidden, class: Permission},
+		{err: errors.New("boom"), class: Unknown},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.class, Classify(c.err), fmt.Sprintf("%v", c.err))
+	}
+}
@@ -6,12 +6,16 @@ var (
 	ErrProviderNotFound = NewCloudKitError("provider not found", "")
 	ErrArgumentInvalid  = NewCloudKitError("argument invalid", "")
 	ErrProviderInit     = NewCloudKitError("provider init error", "")
+	ErrBucketNotFound   = NewCloudKitError("bucket not found", "")
+	ErrCircuitOpen      = NewCloudKitError("circuit open", "the storage is unhealthy, requests are rejected")
 )
 
 type CloudKitError struct {
 	Reason string
 	Detail string
 	Err    error
+	// base is the error the copy was made from by Errorf
+	base *CloudKitError
 }
 
 func NewCloudKitError(reason string, detail string) *CloudKitError {
@@ -37,3 +41,18 @@ func (c *CloudKitError) WithError(err error) *CloudKitError {
 	c.Err = err
 	return c
 }
+
+// Errorf returns a new error with the reason of c and a formatted detail,
+// errors.Is matches it with c. Unlike WithDetail it leaves c untouched, so
+// it's the one to use with the package errors on the request paths.
+func (c *CloudKitError) Errorf(format string, args ...any) *CloudKitError {
+	return &CloudKitError{
+		Reason: c.Reason,
+		Detail: fmt.Sprintf(format, args...),
+		base:   c,
+	}
+}
+
+func (c *CloudKitError) Is(target error) bool {
+	return c.base != nil && c.base == target
+}
@@ -0,0 +1,18 @@
+package oss
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudKitErrorErrorf(t *testing.T) {
+	sentinel := NewCloudKitError("argument invalid", "")
+	err := sentinel.Errorf("key %q cannot be empty", "a")
+	assert.True(t, errors.Is(err, sentinel))
+	assert.False(t, errors.Is(err, ErrArgumentInvalid))
+	assert.Equal(t, "reason: argument invalid; detail: key \"a\" cannot be empty; error: <nil>", err.Error())
+	// the sentinel is left untouched
+	assert.Equal(t, "", sentinel.Detail)
+}
@@ -6,12 +6,18 @@ import (
 	"github.com/langgenius/dify-cloud-kit/oss"
 	"github.com/langgenius/dify-cloud-kit/oss/aliyun"
 	"github.com/langgenius/dify-cloud-kit/oss/azureblob"
+	"github.com/langgenius/dify-cloud-kit/oss/baidubos"
 	"github.com/langgenius/dify-cloud-kit/oss/gcsblob"
 	"github.com/langgenius/dify-cloud-kit/oss/huaweiobs"
 	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/langgenius/dify-cloud-kit/oss/ocistorage"
 	"github.com/langgenius/dify-cloud-kit/oss/s3"
+	"github.com/langgenius/dify-cloud-kit/oss/supabase"
+	"github.com/langgenius/dify-cloud-kit/oss/swift"
 	"github.com/langgenius/dify-cloud-kit/oss/tencentcos"
 	"github.com/langgenius/dify-cloud-kit/oss/volcenginetos"
+	"github.com/langgenius/dify-cloud-kit/oss/webdav"
 )
 
 var OSSFactory = map[string]func(oss.OSSArgs) (oss.OSS, error){
@@ -45,6 +51,31 @@ var OSSFactory = map[string]func(oss.OSSArgs) (oss.OSS, error){
 	"volcengine":     volcenginetos.NewVolcengineTOSStorage,
 	"volcengine_tos": volcenginetos.NewVolcengineTOSStorage,
 	"volcengine-tos": volcenginetos.NewVolcengineTOSStorage,
+
+	"baidu":     baidubos.NewBaiduBOSStorage,
+	"baidu_bos": baidubos.NewBaiduBOSStorage,
+	"baidu-bos": baidubos.NewBaiduBOSStorage,
+	"baidu-obs": baidubos.NewBaiduBOSStorage,
+
+	"oci":         ocistorage.NewOCIStorage,
+	"oci_storage": ocistorage.NewOCIStorage,
+	"oci-storage": ocistorage.NewOCIStorage,
+
+	"supabase":         supabase.NewSupabaseStorage,
+	"supabase_storage": supabase.NewSupabaseStorage,
+	"supabase-storage": supabase.NewSupabaseStorage,
+
+	"swift":           swift.NewSwiftStorage,
+	"openstack_swift": swift.NewSwiftStorage,
+	"openstack-swift": swift.NewSwiftStorage,
+
+	"webdav":  webdav.NewWebDAVStorage,
+	"web_dav": webdav.NewWebDAVStorage,
+	"web-dav": webdav.NewWebDAVStorage,
+
+	"memory":    memory.NewMemoryStorage,
+	"in_memory": memory.NewMemoryStorage,
+	"in-memory": memory.NewMemoryStorage,
 }
 
 func Load(name string, args oss.OSSArgs) (oss.OSS, error) {
@@ -55,3 +86,22 @@ func Load(name string, args oss.OSSArgs) (oss.OSS, error) {
 	}
 	return f(args)
 }
+
+// EnsureBucket loads the provider and applies the provisioning to its bucket,
+// it's meant to be run by installers before the storage is used. The provider
+// is loaded without touching its bucket, the one of args is ignored
+func EnsureBucket(name string, args oss.OSSArgs, provisioning oss.BucketProvisioning) error {
+	err := provisioning.Validate()
+	if err != nil {
+		return err
+	}
+	storage, err := Load(name, args.DeferProvisioning())
+	if err != nil {
+		return err
+	}
+	ensurer, ok := storage.(oss.BucketEnsurer)
+	if !ok {
+		return oss.ErrArgumentInvalid.Errorf("[ %s ] does not support bucket provisioning", name)
+	}
+	return ensurer.EnsureBucket(provisioning)
+}
@@ -0,0 +1,68 @@
+package factory
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCOS serves the bucket requests of Tencent COS for a single bucket
+type fakeCOS struct {
+	mu       sync.Mutex
+	exists   bool
+	requests []string
+}
+
+func (f *fakeCOS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == http.MethodHead && f.exists:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPut:
+		f.exists = true
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestEnsureBucketCreatesMissingBucket(t *testing.T) {
+	fake := &fakeCOS{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	args := oss.OSSArgs{TencentCOS: &oss.TencentCOS{
+		Region:    "ap-guangzhou",
+		SecretID:  "id",
+		SecretKey: "key",
+		Bucket:    "dify-1250000000",
+		Endpoint:  server.URL,
+		Provisioning: oss.BucketProvisioning{
+			Policy: oss.BucketPolicyRequireExisting,
+		},
+	}}
+
+	_, err := Load("tencent", args)
+	assert.True(t, errors.Is(err, oss.ErrBucketNotFound))
+
+	err = EnsureBucket("tencent", args, oss.BucketProvisioning{
+		Policy: oss.BucketPolicyCreateIfMissing,
+		Region: "ap-guangzhou",
+	})
+	assert.Nil(t, err)
+	assert.True(t, fake.exists)
+
+	_, err = Load("tencent", args)
+	assert.Nil(t, err)
+	// the provisioning of args is not applied by EnsureBucket
+	assert.Equal(t, []string{"HEAD /", "HEAD /", "PUT /", "HEAD /"}, fake.requests)
+}
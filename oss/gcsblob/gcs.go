@@ -3,19 +3,25 @@ package gcsblob
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
 	"strings"
 
 	"cloud.google.com/go/storage"
 	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
 type GoogleCloudStorage struct {
-	bucket string
-	client *storage.Client
+	bucket    string
+	projectID string
+	client    *storage.Client
+	ctx       context.Context
 }
 
 func NewGoogleCloudStorage(args oss.OSSArgs) (oss.OSS, error) {
@@ -33,18 +39,85 @@ func NewGoogleCloudStorage(args oss.OSSArgs) (oss.OSS, error) {
 	if err != nil {
 		return nil, oss.ErrProviderInit.WithError(err).WithDetail("credentials must be a base64 encoded string")
 	}
-	client, err := storage.NewClient(ctx, option.WithCredentialsJSON(credentials))
+	httpClient, err := args.GoogleCloudStorage.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	options := []option.ClientOption{option.WithCredentialsJSON(credentials)}
+	if httpClient != nil {
+		// a custom http client skips authentication, so wrap its transport with the credentials
+		transport, err := htransport.NewTransport(ctx, oss.RoundTripper(httpClient),
+			option.WithCredentialsJSON(credentials),
+			option.WithScopes(storage.ScopeFullControl),
+		)
+		if err != nil {
+			return nil, oss.ErrProviderInit.WithError(err)
+		}
+		options = append(options, option.WithHTTPClient(&http.Client{
+			Transport: transport,
+			Timeout:   httpClient.Timeout,
+		}))
+	}
+	client, err := storage.NewClient(ctx, options...)
 	if err != nil {
 		return nil, oss.ErrProviderInit.WithError(err)
 	}
-	return &GoogleCloudStorage{
-		bucket: bucket,
-		client: client,
-	}, nil
+	// the project id is only needed when the bucket is created
+	var account struct {
+		ProjectID string `json:"project_id"`
+	}
+	_ = json.Unmarshal(credentials, &account)
+
+	gcs := &GoogleCloudStorage{
+		bucket:    bucket,
+		projectID: account.ProjectID,
+		client:    client,
+		ctx:       context.Background(),
+	}
+	err = gcs.EnsureBucket(args.GoogleCloudStorage.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(gcs, args.GoogleCloudStorage.Prefix)
+}
+
+func (g *GoogleCloudStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(g.bucket, g.bucketExists, func() error {
+		return g.createBucket(provisioning)
+	})
+}
+
+func (g *GoogleCloudStorage) bucketExists() (bool, error) {
+	_, err := g.client.Bucket(g.bucket).Attrs(context.Background())
+	if err != nil {
+		if errors.Is(err, storage.ErrBucketNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (g *GoogleCloudStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	if g.projectID == "" {
+		return oss.ErrArgumentInvalid.Errorf("credentials must contain project_id to create a bucket")
+	}
+	return g.client.Bucket(g.bucket).Create(context.Background(), g.projectID, &storage.BucketAttrs{
+		Location:          provisioning.Region,
+		PredefinedACL:     provisioning.ACL,
+		VersioningEnabled: provisioning.Versioning,
+	})
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (g *GoogleCloudStorage) WithContext(ctx context.Context) oss.OSS {
+	gcs := *g
+	gcs.ctx = ctx
+	return &gcs
 }
 
 func (g *GoogleCloudStorage) Save(key string, data []byte) error {
-	ctx := context.Background()
+	ctx := g.ctx
 	obj := g.client.Bucket(g.bucket).Object(key)
 
 	wc := obj.NewWriter(ctx)
@@ -55,7 +128,7 @@ func (g *GoogleCloudStorage) Save(key string, data []byte) error {
 }
 
 func (g *GoogleCloudStorage) Load(key string) ([]byte, error) {
-	rc, err := g.client.Bucket(g.bucket).Object(key).NewReader(context.Background())
+	rc, err := g.client.Bucket(g.bucket).Object(key).NewReader(g.ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +144,7 @@ func (g *GoogleCloudStorage) Load(key string) ([]byte, error) {
 func (g *GoogleCloudStorage) Exists(key string) (bool, error) {
 	obj := g.client.Bucket(g.bucket).Object(key)
 
-	_, err := obj.Attrs(context.Background())
+	_, err := obj.Attrs(g.ctx)
 	if err != nil {
 		if errors.Is(err, storage.ErrObjectNotExist) {
 			return false, nil
@@ -84,18 +157,24 @@ func (g *GoogleCloudStorage) Exists(key string) (bool, error) {
 func (g *GoogleCloudStorage) State(key string) (oss.OSSState, error) {
 	obj := g.client.Bucket(g.bucket).Object(key)
 
-	attrs, err := obj.Attrs(context.Background())
+	attrs, err := obj.Attrs(g.ctx)
 	if err != nil {
 		return oss.OSSState{}, err
 	}
 	return oss.OSSState{
 		Size:         attrs.Size,
 		LastModified: attrs.Updated,
+		ETag:         attrs.Etag,
 	}, nil
 }
 
 func (g *GoogleCloudStorage) List(prefix string) ([]oss.OSSPath, error) {
-	ctx := context.Background()
+	// append a slash to the prefix if it doesn't end with one
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	ctx := g.ctx
 	it := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{
 		Prefix: prefix,
 	})
@@ -116,7 +195,7 @@ func (g *GoogleCloudStorage) List(prefix string) ([]oss.OSSPath, error) {
 		key = strings.TrimPrefix(key, "/")
 
 		res = append(res, oss.OSSPath{
-			Path:  attrs.Name,
+			Path:  key,
 			IsDir: false,
 		})
 
@@ -125,7 +204,7 @@ func (g *GoogleCloudStorage) List(prefix string) ([]oss.OSSPath, error) {
 }
 
 func (g *GoogleCloudStorage) Delete(key string) error {
-	ctx := context.Background()
+	ctx := g.ctx
 	obj := g.client.Bucket(g.bucket).Object(key)
 	attrs, err := obj.Attrs(ctx)
 	if err != nil {
@@ -0,0 +1,234 @@
+package hedge
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+const (
+	defaultDelay  = 100 * time.Millisecond
+	defaultBudget = 0.05
+	// samples is the number of latencies the percentile is computed from
+	samples = 1000
+	// minSamples is the number of latencies needed before the percentile is used
+	minSamples = 20
+)
+
+type Options struct {
+	// Delay is how long the first request runs before the second one is sent,
+	// it's also used until enough latencies are known for Percentile, defaults to 100ms
+	Delay time.Duration
+	// Percentile sends the second request once the first one is slower than
+	// this percentile of the recent latencies, e.g. 0.95, Delay is used if zero
+	Percentile float64
+	// Budget caps the second requests to this ratio of the calls, defaults to 0.05
+	Budget float64
+}
+
+// Stats counts the hedged calls
+type Stats struct {
+	// Calls is the number of Load and State calls
+	Calls uint64
+	// Hedges is the number of second requests sent
+	Hedges uint64
+	// Wins is the number of second requests which finished first
+	Wins uint64
+}
+
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencies) record(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < samples {
+		l.samples = append(l.samples, latency)
+		return
+	}
+	l.samples[l.next] = latency
+	l.next = (l.next + 1) % samples
+}
+
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	sorted := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+	if len(sorted) < minSamples {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[min(int(p*float64(len(sorted))), len(sorted)-1)], true
+}
+
+type counters struct {
+	calls  atomic.Uint64
+	hedges atomic.Uint64
+	wins   atomic.Uint64
+}
+
+// HedgeStorage sends a second Load or State request when the first one is
+// slow and returns whichever finishes first, the other one is canceled if
+// the wrapped storage supports contexts. The other operations are passed
+// through.
+type HedgeStorage struct {
+	inner     oss.OSS
+	opts      Options
+	ctx       context.Context
+	latencies *latencies
+	counters  *counters
+}
+
+func NewHedgeStorage(inner oss.OSS, opts Options) *HedgeStorage {
+	if opts.Delay <= 0 {
+		opts.Delay = defaultDelay
+	}
+	if opts.Budget <= 0 {
+		opts.Budget = defaultBudget
+	}
+	return &HedgeStorage{
+		inner:     inner,
+		opts:      opts,
+		ctx:       context.Background(),
+		latencies: &latencies{},
+		counters:  &counters{},
+	}
+}
+
+func (h *HedgeStorage) delay() time.Duration {
+	if h.opts.Percentile > 0 {
+		if delay, ok := h.latencies.percentile(h.opts.Percentile); ok {
+			return delay
+		}
+	}
+	return h.opts.Delay
+}
+
+// reserve takes a second request from the budget
+func (h *HedgeStorage) reserve() bool {
+	for {
+		hedges := h.counters.hedges.Load()
+		// one second request is allowed before the calls build the budget up
+		if float64(hedges) > h.opts.Budget*float64(h.counters.calls.Load()) {
+			return false
+		}
+		if h.counters.hedges.CompareAndSwap(hedges, hedges+1) {
+			return true
+		}
+	}
+}
+
+// WithContext returns a copy of the storage which shares the latencies and
+// the budget with the original one
+func (h *HedgeStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *h
+	storage.ctx = ctx
+	storage.inner = oss.WithContext(ctx, h.inner)
+	return &storage
+}
+
+func (h *HedgeStorage) Unwrap() oss.OSS {
+	return h.inner
+}
+
+// Stats returns the counts of the hedged calls
+func (h *HedgeStorage) Stats() Stats {
+	return Stats{
+		Calls:  h.counters.calls.Load(),
+		Hedges: h.counters.hedges.Load(),
+		Wins:   h.counters.wins.Load(),
+	}
+}
+
+func (h *HedgeStorage) Load(key string) ([]byte, error) {
+	return hedge(h, func(storage oss.OSS) ([]byte, error) {
+		return storage.Load(key)
+	})
+}
+
+func (h *HedgeStorage) State(key string) (oss.OSSState, error) {
+	return hedge(h, func(storage oss.OSS) (oss.OSSState, error) {
+		return storage.State(key)
+	})
+}
+
+func (h *HedgeStorage) Save(key string, data []byte) error {
+	return h.inner.Save(key, data)
+}
+
+func (h *HedgeStorage) Exists(key string) (bool, error) {
+	return h.inner.Exists(key)
+}
+
+func (h *HedgeStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return h.inner.List(prefix)
+}
+
+func (h *HedgeStorage) Delete(key string) error {
+	return h.inner.Delete(key)
+}
+
+func (h *HedgeStorage) Type() string {
+	return h.inner.Type()
+}
+
+type result[T any] struct {
+	value  T
+	err    error
+	hedged bool
+}
+
+func hedge[T any](h *HedgeStorage, fn func(oss.OSS) (T, error)) (T, error) {
+	h.counters.calls.Add(1)
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	// the request which loses is canceled
+	defer cancel()
+
+	results := make(chan result[T], 2)
+	send := func(hedged bool) {
+		start := time.Now()
+		go func() {
+			value, err := fn(oss.WithContext(ctx, h.inner))
+			if err == nil {
+				h.latencies.record(time.Since(start))
+			}
+			results <- result[T]{value: value, err: err, hedged: hedged}
+		}()
+	}
+
+	send(false)
+	timer := time.NewTimer(h.delay())
+	defer timer.Stop()
+
+	pending := 1
+	var last result[T]
+	for {
+		select {
+		case <-timer.C:
+			if h.reserve() {
+				send(true)
+				pending++
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil || pending == 0 {
+				if r.err == nil && r.hedged {
+					h.counters.wins.Add(1)
+				}
+				return r.value, r.err
+			}
+			// the other request may still succeed
+			last = r
+		case <-ctx.Done():
+			return last.value, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package hedge
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowStorage makes every odd load slow, the slow loads stop when their context is canceled
+type slowStorage struct {
+	oss.OSS
+	ctx      context.Context
+	loads    *atomic.Int32
+	canceled *atomic.Int32
+}
+
+func (s *slowStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
+func (s *slowStorage) Load(key string) ([]byte, error) {
+	if s.loads.Add(1)%2 == 1 {
+		select {
+		case <-time.After(time.Second):
+		case <-s.ctx.Done():
+			s.canceled.Add(1)
+			return nil, s.ctx.Err()
+		}
+	}
+	return s.OSS.Load(key)
+}
+
+func newSlowStorage(t *testing.T) *slowStorage {
+	storage, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	return &slowStorage{
+		OSS:      storage,
+		ctx:      context.Background(),
+		loads:    &atomic.Int32{},
+		canceled: &atomic.Int32{},
+	}
+}
+
+func TestHedgeLoad(t *testing.T) {
+	inner := newSlowStorage(t)
+	assert.Nil(t, inner.Save("a", []byte("a")))
+	storage := NewHedgeStorage(inner, Options{Delay: 10 * time.Millisecond, Budget: 1})
+
+	start := time.Now()
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	assert.Eventually(t, func() bool { return inner.canceled.Load() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, Stats{Calls: 1, Hedges: 1, Wins: 1}, storage.Stats())
+}
+
+func TestHedgeBudget(t *testing.T) {
+	inner := newSlowStorage(t)
+	assert.Nil(t, inner.Save("a", []byte("a")))
+	storage := NewHedgeStorage(inner, Options{Delay: 10 * time.Millisecond, Budget: 0.01})
+
+	_, err := storage.Load("a")
+	assert.Nil(t, err)
+
+	// the budget is spent, so the next slow load is not hedged
+	start := time.Now()
+	_, err = storage.Load("a")
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, uint64(1), storage.Stats().Hedges)
+}
@@ -1,7 +1,9 @@
 package huaweiobs
 
 import (
+	"context"
 	"io"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -10,11 +12,15 @@ import (
 
 	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
 	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 )
 
 type HuaweiOBSStorage struct {
 	bucket string
 	client *obs.ObsClient
+	// newClient builds a client whose requests are bound to ctx, the sdk
+	// only takes a context per client
+	newClient func(ctx context.Context) (*obs.ObsClient, error)
 }
 
 func NewHuaweiOBSStorage(args oss.OSSArgs) (oss.OSS, error) {
@@ -31,15 +37,92 @@ func NewHuaweiOBSStorage(args oss.OSSArgs) (oss.OSS, error) {
 	endpoint := args.HuaweiOBS.Server
 	bucket := args.HuaweiOBS.Bucket
 	pathStyle := args.HuaweiOBS.PathStyle
-	client, err := obs.New(ak, sk, endpoint, obs.WithPathStyle(pathStyle))
+	httpClient, err := args.HuaweiOBS.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		// redirects are handled by the sdk itself
+		noRedirectClient := *httpClient
+		noRedirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		httpClient = &noRedirectClient
+	}
+	// a nil http client keeps the default one of the sdk
+	newClient := func(ctx context.Context) (*obs.ObsClient, error) {
+		return obs.New(ak, sk, endpoint, obs.WithPathStyle(pathStyle), obs.WithHttpClient(httpClient), obs.WithRequestContext(ctx))
+	}
+	client, err := newClient(context.Background())
 	if err != nil {
 		return nil, oss.ErrProviderInit.WithError(err)
 	}
 
-	return &HuaweiOBSStorage{
-		bucket: bucket,
-		client: client,
-	}, nil
+	storage := &HuaweiOBSStorage{
+		bucket:    bucket,
+		client:    client,
+		newClient: newClient,
+	}
+	err = storage.EnsureBucket(args.HuaweiOBS.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.HuaweiOBS.Prefix)
+}
+
+func (h *HuaweiOBSStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(h.bucket, h.bucketExists, func() error {
+		return h.createBucket(provisioning)
+	})
+}
+
+func (h *HuaweiOBSStorage) bucketExists() (bool, error) {
+	_, err := h.client.HeadBucket(h.bucket)
+	if err == nil {
+		return true, nil
+	}
+
+	if obsErr, ok := err.(obs.ObsError); ok && obsErr.StatusCode == 404 {
+		return false, nil
+	}
+	return false, err
+}
+
+func (h *HuaweiOBSStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	_, err := h.client.CreateBucket(&obs.CreateBucketInput{
+		BucketLocation: obs.BucketLocation{
+			Location: provisioning.Region,
+		},
+		Bucket: h.bucket,
+		ACL:    obs.AclType(provisioning.ACL),
+	})
+	if err != nil {
+		return err
+	}
+
+	if provisioning.Versioning {
+		_, err = h.client.SetBucketVersioning(&obs.SetBucketVersioningInput{
+			Bucket: h.bucket,
+			BucketVersioningConfiguration: obs.BucketVersioningConfiguration{
+				Status: obs.VersioningStatusEnabled,
+			},
+		})
+	}
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx.
+// The copy gets its own sdk client, with a Transport the copies share its
+// http client, without one the sdk opens new connections for every copy.
+// The sdk still sleeps between its retries once ctx is done.
+func (h *HuaweiOBSStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *h
+	client, err := h.newClient(ctx)
+	// the same arguments built the client of h, so it can't fail
+	if err == nil {
+		storage.client = client
+	}
+	return &storage
 }
 
 func (h *HuaweiOBSStorage) Save(key string, data []byte) error {
@@ -111,11 +194,12 @@ func (h *HuaweiOBSStorage) State(key string) (oss.OSSState, error) {
 	return oss.OSSState{
 		Size:         output.ContentLength,
 		LastModified: output.LastModified,
+		ETag:         output.ETag,
 	}, nil
 }
 
 func (h *HuaweiOBSStorage) List(prefix string) ([]oss.OSSPath, error) {
-	if !strings.HasSuffix(prefix, "/") {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 
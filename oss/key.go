@@ -0,0 +1,18 @@
+package oss
+
+import "strings"
+
+// ValidateKey rejects the absolute paths and the dot segments, which could
+// match a prefix but resolve outside of it on some storages. Both / and \
+// are treated as separators.
+func ValidateKey(key string) error {
+	if strings.HasPrefix(key, "/") || strings.HasPrefix(key, "\\") {
+		return ErrArgumentInvalid.Errorf("key %q cannot be an absolute path", key)
+	}
+	for _, segment := range strings.FieldsFunc(key, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == "." || segment == ".." {
+			return ErrArgumentInvalid.Errorf("key %q cannot contain %q", key, segment)
+		}
+	}
+	return nil
+}
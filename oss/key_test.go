@@ -0,0 +1,17 @@
+package oss
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{"a", "a/b.txt", "a..b/c", ".hidden/x", "a//b"} {
+		assert.Nil(t, ValidateKey(key), key)
+	}
+	for _, key := range []string{"/a", "\\a", "a/../b", "..", "a/./b", "a\\..\\b"} {
+		assert.True(t, errors.Is(ValidateKey(key), ErrArgumentInvalid), key)
+	}
+}
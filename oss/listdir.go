@@ -0,0 +1,43 @@
+package oss
+
+import (
+	"sort"
+	"strings"
+)
+
+// DirLister is implemented by the storages which list one level below a
+// prefix without walking the whole tree
+type DirLister interface {
+	// ListDir lists the objects and the directories right below prefix, the
+	// directories are returned with IsDir and without the trailing slash
+	ListDir(prefix string) ([]OSSPath, error)
+}
+
+// ListDir lists one level below prefix, through DirLister if the storage
+// implements it, otherwise by folding the result of List
+func ListDir(storage OSS, prefix string) ([]OSSPath, error) {
+	if lister, ok := storage.(DirLister); ok {
+		return lister.ListDir(prefix)
+	}
+	paths, err := storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	dirs := map[string]bool{}
+	keys := make([]OSSPath, 0, len(paths))
+	for _, p := range paths {
+		name, _, nested := strings.Cut(p.Path, "/")
+		if !nested && !p.IsDir {
+			keys = append(keys, OSSPath{Path: name})
+			continue
+		}
+		if !dirs[name] {
+			dirs[name] = true
+			keys = append(keys, OSSPath{Path: name, IsDir: true})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Path < keys[j].Path
+	})
+	return keys, nil
+}
@@ -0,0 +1,403 @@
+package memcache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultMaxBytes      = 64 << 20
+	defaultMaxObjectSize = 1 << 20
+	defaultMaxEntries    = 16384
+	defaultNegativeTTL   = time.Second
+
+	// maxMissing bounds the number of remembered missing keys
+	maxMissing = 4096
+)
+
+type Options struct {
+	// MaxBytes bounds the total size of the cached objects, defaults to 64MiB
+	MaxBytes int64
+	// MaxObjectSize is the size of the largest object kept in memory, defaults to 1MiB
+	MaxObjectSize int64
+	// MaxEntries bounds the number of cached keys, so the states which take
+	// no bytes are bounded too, defaults to 16384
+	MaxEntries int
+	// TTL is how long a cached object or state is served, zero keeps them
+	// until they are evicted or changed through the wrapper
+	TTL time.Duration
+	// NegativeTTL is how long Exists remembers a missing key, defaults to 1s
+	NegativeTTL time.Duration
+}
+
+type entry struct {
+	key       string
+	data      []byte
+	hasData   bool
+	state     oss.OSSState
+	hasState  bool
+	expiresAt time.Time
+	element   *list.Element
+}
+
+// fetch counts the calls fetching a key, generation changes on every
+// invalidation of the key
+type fetch struct {
+	calls      int
+	generation uint64
+}
+
+type cache struct {
+	maxBytes      int64
+	maxObjectSize int64
+	maxEntries    int
+	ttl           time.Duration
+	negativeTTL   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// lru holds the entries from the most to the least recently used
+	lru  *list.List
+	size int64
+	// missing holds the expiry of the negative Exists results
+	missing map[string]time.Time
+	// fetches holds the keys being fetched from the wrapped storage, a
+	// result is not cached if its key was invalidated during the fetch
+	fetches map[string]*fetch
+
+	group singleflight.Group
+}
+
+// MemCacheStorage keeps small hot objects in memory, concurrent Load, State
+// and Exists calls for the same key are merged into a single call of the
+// wrapped storage. Save and Delete through the wrapper invalidate the key.
+type MemCacheStorage struct {
+	inner oss.OSS
+	cache *cache
+}
+
+func NewMemCacheStorage(inner oss.OSS, opts Options) *MemCacheStorage {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.MaxObjectSize <= 0 {
+		opts.MaxObjectSize = defaultMaxObjectSize
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultMaxEntries
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultNegativeTTL
+	}
+	return &MemCacheStorage{
+		inner: inner,
+		cache: &cache{
+			maxBytes:      opts.MaxBytes,
+			maxObjectSize: min(opts.MaxObjectSize, opts.MaxBytes),
+			maxEntries:    opts.MaxEntries,
+			ttl:           opts.TTL,
+			negativeTTL:   opts.NegativeTTL,
+			entries:       map[string]*entry{},
+			lru:           list.New(),
+			missing:       map[string]time.Time{},
+			fetches:       map[string]*fetch{},
+		},
+	}
+}
+
+// lookup returns the live entry of key and marks it as recently used
+func (c *cache) lookup(key string) (*entry, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.ttl > 0 && time.Now().After(e.expiresAt) {
+		c.removeLocked(e)
+		return nil, false
+	}
+	c.lru.MoveToFront(e.element)
+	return e, true
+}
+
+func (c *cache) data(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.lookup(key)
+	if !ok || !e.hasData {
+		return nil, false
+	}
+	return e.data, true
+}
+
+func (c *cache) state(key string) (oss.OSSState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.lookup(key)
+	if !ok || !e.hasState {
+		return oss.OSSState{}, false
+	}
+	return e.state, true
+}
+
+// exists answers from the cached objects, states and negative results
+func (c *cache) exists(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.lookup(key); ok {
+		return true, true
+	}
+	if expiresAt, ok := c.missing[key]; ok {
+		if time.Now().Before(expiresAt) {
+			return false, true
+		}
+		delete(c.missing, key)
+	}
+	return false, false
+}
+
+// begin registers a fetch of key and returns the generation of the key,
+// finish must be called once the result is cached
+func (c *cache) begin(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.fetches[key]
+	if !ok {
+		f = &fetch{}
+		c.fetches[key] = f
+	}
+	f.calls++
+	return f.generation
+}
+
+func (c *cache) finish(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.fetches[key]
+	f.calls--
+	if f.calls == 0 {
+		delete(c.fetches, key)
+	}
+}
+
+// currentLocked reports whether key was not invalidated since the fetch began
+func (c *cache) currentLocked(key string, generation uint64) bool {
+	f, ok := c.fetches[key]
+	return ok && f.generation == generation
+}
+
+// entryLocked returns the entry to update with a result fetched at generation,
+// it returns nil if the key was invalidated in the meantime
+func (c *cache) entryLocked(key string, generation uint64) *entry {
+	if !c.currentLocked(key, generation) {
+		return nil
+	}
+	delete(c.missing, key)
+	e, ok := c.lookup(key)
+	if !ok {
+		e = &entry{key: key}
+		e.element = c.lru.PushFront(e)
+		c.entries[key] = e
+	}
+	if c.ttl > 0 && !e.hasData && !e.hasState {
+		e.expiresAt = time.Now().Add(c.ttl)
+	}
+	return e
+}
+
+func (c *cache) putData(key string, data []byte, generation uint64) {
+	if int64(len(data)) > c.maxObjectSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entryLocked(key, generation)
+	if e == nil {
+		return
+	}
+	c.size -= int64(len(e.data))
+	e.data = data
+	e.hasData = true
+	c.size += int64(len(data))
+	c.evict()
+}
+
+func (c *cache) putState(key string, state oss.OSSState, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entryLocked(key, generation)
+	if e == nil {
+		return
+	}
+	e.state = state
+	e.hasState = true
+	c.evict()
+}
+
+func (c *cache) putMissing(key string, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.currentLocked(key, generation) {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.removeLocked(e)
+	}
+	now := time.Now()
+	if len(c.missing) >= maxMissing {
+		for missingKey, expiresAt := range c.missing {
+			if now.After(expiresAt) {
+				delete(c.missing, missingKey)
+			}
+		}
+		if len(c.missing) >= maxMissing {
+			return
+		}
+	}
+	c.missing[key] = now.Add(c.negativeTTL)
+}
+
+func (c *cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.fetches[key]; ok {
+		f.generation++
+	}
+	delete(c.missing, key)
+	if e, ok := c.entries[key]; ok {
+		c.removeLocked(e)
+	}
+	// later calls must not join the calls started before the invalidation
+	c.group.Forget(loadKey(key))
+	c.group.Forget(stateKey(key))
+	c.group.Forget(existsKey(key))
+}
+
+func (c *cache) removeLocked(e *entry) {
+	c.lru.Remove(e.element)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.data))
+}
+
+func (c *cache) evict() {
+	for c.size > c.maxBytes || c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.removeLocked(oldest.Value.(*entry))
+	}
+}
+
+func loadKey(key string) string   { return "load:" + key }
+func stateKey(key string) string  { return "state:" + key }
+func existsKey(key string) string { return "exists:" + key }
+
+// WithContext returns a copy of the storage which shares the cache with the
+// original one, merged calls run under the context of the first caller
+func (m *MemCacheStorage) WithContext(ctx context.Context) oss.OSS {
+	return &MemCacheStorage{
+		inner: oss.WithContext(ctx, m.inner),
+		cache: m.cache,
+	}
+}
+
+func (m *MemCacheStorage) Unwrap() oss.OSS {
+	return m.inner
+}
+
+// Size returns the total size of the cached objects
+func (m *MemCacheStorage) Size() int64 {
+	m.cache.mu.Lock()
+	defer m.cache.mu.Unlock()
+	return m.cache.size
+}
+
+// Load returns a copy of the cached object, so callers may modify it
+func (m *MemCacheStorage) Load(key string) ([]byte, error) {
+	if data, ok := m.cache.data(key); ok {
+		return bytes.Clone(data), nil
+	}
+
+	result, err, _ := m.cache.group.Do(loadKey(key), func() (any, error) {
+		generation := m.cache.begin(key)
+		defer m.cache.finish(key)
+		data, err := m.inner.Load(key)
+		if err != nil {
+			return nil, err
+		}
+		m.cache.putData(key, data, generation)
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(result.([]byte)), nil
+}
+
+func (m *MemCacheStorage) State(key string) (oss.OSSState, error) {
+	if state, ok := m.cache.state(key); ok {
+		return state, nil
+	}
+
+	result, err, _ := m.cache.group.Do(stateKey(key), func() (any, error) {
+		generation := m.cache.begin(key)
+		defer m.cache.finish(key)
+		state, err := m.inner.State(key)
+		if err != nil {
+			return nil, err
+		}
+		m.cache.putState(key, state, generation)
+		return state, nil
+	})
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	return result.(oss.OSSState), nil
+}
+
+func (m *MemCacheStorage) Exists(key string) (bool, error) {
+	if exists, ok := m.cache.exists(key); ok {
+		return exists, nil
+	}
+
+	result, err, _ := m.cache.group.Do(existsKey(key), func() (any, error) {
+		generation := m.cache.begin(key)
+		defer m.cache.finish(key)
+		exists, err := m.inner.Exists(key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			m.cache.putMissing(key, generation)
+		}
+		return exists, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+func (m *MemCacheStorage) Save(key string, data []byte) error {
+	defer m.cache.invalidate(key)
+	return m.inner.Save(key, data)
+}
+
+func (m *MemCacheStorage) Delete(key string) error {
+	defer m.cache.invalidate(key)
+	return m.inner.Delete(key)
+}
+
+func (m *MemCacheStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return m.inner.List(prefix)
+}
+
+func (m *MemCacheStorage) Type() string {
+	return m.inner.Type()
+}
@@ -0,0 +1,154 @@
+package memcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStorage counts the calls reaching the storage, loads are slowed
+// down so concurrent callers overlap
+type countingStorage struct {
+	oss.OSS
+	loads  atomic.Int32
+	exists atomic.Int32
+}
+
+func (c *countingStorage) Load(key string) ([]byte, error) {
+	c.loads.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return c.OSS.Load(key)
+}
+
+func (c *countingStorage) Exists(key string) (bool, error) {
+	c.exists.Add(1)
+	return c.OSS.Exists(key)
+}
+
+func newCountingStorage(t *testing.T) *countingStorage {
+	storage, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	return &countingStorage{OSS: storage}
+}
+
+func TestMemCacheSingleflight(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("manifest.yaml", []byte("version: 1")))
+	storage := NewMemCacheStorage(inner, Options{})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := storage.Load("manifest.yaml")
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("version: 1"), data)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), inner.loads.Load())
+
+	// callers get their own copy
+	data, _ := storage.Load("manifest.yaml")
+	data[0] = 'X'
+	data, _ = storage.Load("manifest.yaml")
+	assert.Equal(t, []byte("version: 1"), data)
+	assert.Equal(t, int32(1), inner.loads.Load())
+
+	assert.Nil(t, storage.Save("manifest.yaml", []byte("version: 2")))
+	data, err := storage.Load("manifest.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("version: 2"), data)
+	assert.Equal(t, int32(2), inner.loads.Load())
+}
+
+func TestMemCacheBounds(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("a", make([]byte, 40)))
+	assert.Nil(t, inner.Save("b", make([]byte, 40)))
+	assert.Nil(t, inner.Save("c", make([]byte, 40)))
+	assert.Nil(t, inner.Save("large", make([]byte, 60)))
+	storage := NewMemCacheStorage(inner, Options{MaxBytes: 100, MaxObjectSize: 50})
+
+	for _, key := range []string{"a", "b", "c", "large"} {
+		_, err := storage.Load(key)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int64(80), storage.Size())
+
+	// a was evicted and large is never cached
+	inner.loads.Store(0)
+	for _, key := range []string{"b", "c", "a", "large"} {
+		_, err := storage.Load(key)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(2), inner.loads.Load())
+}
+
+func TestMemCacheNegativeExists(t *testing.T) {
+	inner := newCountingStorage(t)
+	storage := NewMemCacheStorage(inner, Options{NegativeTTL: 50 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		exists, err := storage.Exists("missing")
+		assert.Nil(t, err)
+		assert.False(t, exists)
+	}
+	assert.Equal(t, int32(1), inner.exists.Load())
+
+	time.Sleep(60 * time.Millisecond)
+	_, err := storage.Exists("missing")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), inner.exists.Load())
+
+	// saving through the wrapper forgets the negative result
+	assert.Nil(t, storage.Save("missing", []byte("x")))
+	exists, err := storage.Exists("missing")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestMemCacheInvalidatesOnlyTheKey(t *testing.T) {
+	inner := newCountingStorage(t)
+	assert.Nil(t, inner.Save("a", []byte("a")))
+	storage := NewMemCacheStorage(inner, Options{})
+
+	// saving b during the load of a keeps the loaded a
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := storage.Load("a")
+		assert.Nil(t, err)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, storage.Save("b", []byte("b")))
+	<-done
+
+	_, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), inner.loads.Load())
+}
+
+func TestMemCacheBoundsEntries(t *testing.T) {
+	inner := newCountingStorage(t)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Nil(t, inner.Save(key, []byte(key)))
+	}
+	storage := NewMemCacheStorage(inner, Options{MaxEntries: 2})
+
+	// states take no bytes but are bounded by the entry count
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := storage.State(key)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int64(0), storage.Size())
+	assert.Equal(t, 2, storage.cache.lru.Len())
+	_, ok := storage.cache.state("a")
+	assert.False(t, ok)
+}
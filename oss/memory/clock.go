@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a manual clock for SetNow, it only moves when told to
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
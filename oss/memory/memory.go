@@ -0,0 +1,193 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+type object struct {
+	data         []byte
+	lastModified time.Time
+	etag         string
+}
+
+type store struct {
+	mu      sync.RWMutex
+	objects map[string]object
+	now     func() time.Time
+}
+
+// MemoryStorage keeps the objects in a map, it's meant for unit tests. Keys
+// are flat like in the buckets of the cloud drivers: a missing key is
+// reported with an error wrapping fs.ErrNotExist, deleting it succeeds and
+// List returns every object below a prefix.
+type MemoryStorage struct {
+	store *store
+	ctx   context.Context
+}
+
+func NewMemoryStorage(args oss.OSSArgs) (oss.OSS, error) {
+	memory := args.Memory
+	if memory == nil {
+		memory = &oss.Memory{}
+	}
+	err := memory.Validate()
+	if err != nil {
+		return nil, err
+	}
+	storage := New()
+	if memory.Now != nil {
+		storage.SetNow(memory.Now)
+	}
+	return storage, nil
+}
+
+// New returns an empty storage
+func New() *MemoryStorage {
+	return &MemoryStorage{
+		store: &store{objects: map[string]object{}, now: time.Now},
+		ctx:   context.Background(),
+	}
+}
+
+// SetNow replaces the clock giving the LastModified of the saved objects
+func (m *MemoryStorage) SetNow(now func() time.Time) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.now = now
+}
+
+// Snapshot returns a copy of the contents by key
+func (m *MemoryStorage) Snapshot() map[string][]byte {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	snapshot := make(map[string][]byte, len(m.store.objects))
+	for key, obj := range m.store.objects {
+		snapshot[key] = bytes.Clone(obj.data)
+	}
+	return snapshot
+}
+
+// Restore replaces the contents with snapshot, the objects are modified now
+func (m *MemoryStorage) Restore(snapshot map[string][]byte) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.objects = make(map[string]object, len(snapshot))
+	for key, data := range snapshot {
+		m.store.objects[key] = m.store.newObject(data)
+	}
+}
+
+// newObject must be called with the lock held
+func (s *store) newObject(data []byte) object {
+	sum := md5.Sum(data)
+	return object{
+		data:         bytes.Clone(data),
+		lastModified: s.now(),
+		etag:         hex.EncodeToString(sum[:]),
+	}
+}
+
+func (m *MemoryStorage) lookup(op oss.Operation, key string) (object, error) {
+	if err := m.ctx.Err(); err != nil {
+		return object{}, err
+	}
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	obj, ok := m.store.objects[key]
+	if !ok {
+		return object{}, &fs.PathError{Op: string(op), Path: key, Err: fs.ErrNotExist}
+	}
+	return obj, nil
+}
+
+// WithContext returns a storage sharing the objects whose operations fail once ctx is done
+func (m *MemoryStorage) WithContext(ctx context.Context) oss.OSS {
+	return &MemoryStorage{store: m.store, ctx: ctx}
+}
+
+func (m *MemoryStorage) Save(key string, data []byte) error {
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.objects[key] = m.store.newObject(data)
+	return nil
+}
+
+func (m *MemoryStorage) Load(key string) ([]byte, error) {
+	obj, err := m.lookup(oss.OperationLoad, key)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(obj.data), nil
+}
+
+func (m *MemoryStorage) Exists(key string) (bool, error) {
+	if err := m.ctx.Err(); err != nil {
+		return false, err
+	}
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	_, ok := m.store.objects[key]
+	return ok, nil
+}
+
+func (m *MemoryStorage) State(key string) (oss.OSSState, error) {
+	obj, err := m.lookup(oss.OperationState, key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	return oss.OSSState{
+		Size:         int64(len(obj.data)),
+		LastModified: obj.lastModified,
+		ETag:         obj.etag,
+	}, nil
+}
+
+// List returns the objects below prefix relative to it, sorted by path
+func (m *MemoryStorage) List(prefix string) ([]oss.OSSPath, error) {
+	if err := m.ctx.Err(); err != nil {
+		return nil, err
+	}
+	// append a slash to the prefix if it doesn't end with one, an empty prefix lists everything
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	m.store.mu.RLock()
+	paths := make([]oss.OSSPath, 0)
+	for key := range m.store.objects {
+		if strings.HasPrefix(key, prefix) {
+			paths = append(paths, oss.OSSPath{Path: strings.TrimPrefix(key, prefix)})
+		}
+	}
+	m.store.mu.RUnlock()
+
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+	return paths, nil
+}
+
+func (m *MemoryStorage) Delete(key string) error {
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	delete(m.store.objects, key)
+	return nil
+}
+
+func (m *MemoryStorage) Type() string {
+	return oss.OSS_TYPE_MEMORY
+}
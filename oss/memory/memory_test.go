@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	clock := NewClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	storage, err := NewMemoryStorage(oss.OSSArgs{Memory: &oss.Memory{Now: clock.Now}})
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSS_TYPE_MEMORY, storage.Type())
+
+	_, err = storage.Load("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+	_, err = storage.State("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+
+	data := []byte("data")
+	assert.Nil(t, storage.Save("plugins/a.pkg", data))
+	data[0] = 'x'
+	clock.Advance(time.Hour)
+	assert.Nil(t, storage.Save("plugins/b/c.pkg", []byte("other")))
+	assert.Nil(t, storage.Save("pluginsx", []byte("sibling")))
+
+	loaded, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), loaded)
+
+	state, err := storage.State("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), state.Size)
+	assert.Equal(t, clock.Now().Add(-time.Hour), state.LastModified)
+	assert.Equal(t, "8d777f385d3dfec8815d20f7496026dc", state.ETag)
+
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "b/c.pkg"}}, paths)
+	paths, err = storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(paths))
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	exists, err := storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = oss.WithContext(ctx, storage).Load("plugins/b/c.pkg")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	storage := New()
+	assert.Nil(t, storage.Save("a", []byte("1")))
+	snapshot := storage.Snapshot()
+	assert.Equal(t, map[string][]byte{"a": []byte("1")}, snapshot)
+
+	assert.Nil(t, storage.Save("a", []byte("2")))
+	assert.Nil(t, storage.Save("b", []byte("3")))
+	storage.Restore(snapshot)
+	assert.Equal(t, snapshot, storage.Snapshot())
+}
+
+func TestMemoryConcurrency(t *testing.T) {
+	storage := New()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("%d/%d", i, j)
+				assert.Nil(t, storage.Save(key, []byte(key)))
+				_, err := storage.List(fmt.Sprint(i))
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	paths, err := storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, 800, len(paths))
+}
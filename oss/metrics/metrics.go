@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+)
+
+type Options struct {
+	// Namespace prefixes the names of the metrics, e.g. dify_oss_operations_total
+	Namespace string
+	// ConstLabels are added to every metric
+	ConstLabels prometheus.Labels
+	// Buckets of the latency histogram in seconds, prometheus.DefBuckets is used by default
+	Buckets []float64
+}
+
+// Collector holds the metrics of storage operations, one collector can be
+// shared by the wrappers of several storages, they are told apart by the type label
+type Collector struct {
+	operations   *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	readBytes    *prometheus.CounterVec
+	writtenBytes *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+}
+
+func NewCollector(opts Options) *Collector {
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "oss",
+			Name:        "operations_total",
+			Help:        "Number of storage operations by outcome.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"type", "operation", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "oss",
+			Name:        "operation_duration_seconds",
+			Help:        "Latency of storage operations.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     buckets,
+		}, []string{"type", "operation"}),
+		readBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "oss",
+			Name:        "read_bytes_total",
+			Help:        "Bytes loaded from the storage.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"type"}),
+		writtenBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "oss",
+			Name:        "written_bytes_total",
+			Help:        "Bytes saved into the storage.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "oss",
+			Name:        "errors_total",
+			Help:        "Number of failed storage operations by error class.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"type", "operation", "class"}),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.duration.Describe(ch)
+	c.readBytes.Describe(ch)
+	c.writtenBytes.Describe(ch)
+	c.errors.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.duration.Collect(ch)
+	c.readBytes.Collect(ch)
+	c.writtenBytes.Collect(ch)
+	c.errors.Collect(ch)
+}
+
+// Register registers the collector on reg, e.g. prometheus.DefaultRegisterer
+func (c *Collector) Register(reg prometheus.Registerer) error {
+	return reg.Register(c)
+}
+
+func (c *Collector) observe(storageType string, op oss.Operation, start time.Time, err error) {
+	c.duration.WithLabelValues(storageType, string(op)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.operations.WithLabelValues(storageType, string(op), outcomeError).Inc()
+		c.errors.WithLabelValues(storageType, string(op), string(errclass.Classify(err))).Inc()
+		return
+	}
+	c.operations.WithLabelValues(storageType, string(op), outcomeSuccess).Inc()
+}
+
+// MetricsStorage records the operations of a storage into a Collector
+type MetricsStorage struct {
+	inner     oss.OSS
+	collector *Collector
+}
+
+func NewMetricsStorage(inner oss.OSS, collector *Collector) *MetricsStorage {
+	return &MetricsStorage{
+		inner:     inner,
+		collector: collector,
+	}
+}
+
+func (m *MetricsStorage) WithContext(ctx context.Context) oss.OSS {
+	return &MetricsStorage{
+		inner:     oss.WithContext(ctx, m.inner),
+		collector: m.collector,
+	}
+}
+
+func (m *MetricsStorage) Unwrap() oss.OSS {
+	return m.inner
+}
+
+func (m *MetricsStorage) Save(key string, data []byte) error {
+	start := time.Now()
+	err := m.inner.Save(key, data)
+	m.collector.observe(m.inner.Type(), oss.OperationSave, start, err)
+	if err == nil {
+		m.collector.writtenBytes.WithLabelValues(m.inner.Type()).Add(float64(len(data)))
+	}
+	return err
+}
+
+func (m *MetricsStorage) Load(key string) ([]byte, error) {
+	start := time.Now()
+	data, err := m.inner.Load(key)
+	m.collector.observe(m.inner.Type(), oss.OperationLoad, start, err)
+	if err == nil {
+		m.collector.readBytes.WithLabelValues(m.inner.Type()).Add(float64(len(data)))
+	}
+	return data, err
+}
+
+func (m *MetricsStorage) Exists(key string) (bool, error) {
+	start := time.Now()
+	exists, err := m.inner.Exists(key)
+	m.collector.observe(m.inner.Type(), oss.OperationExists, start, err)
+	return exists, err
+}
+
+func (m *MetricsStorage) State(key string) (oss.OSSState, error) {
+	start := time.Now()
+	state, err := m.inner.State(key)
+	m.collector.observe(m.inner.Type(), oss.OperationState, start, err)
+	return state, err
+}
+
+func (m *MetricsStorage) List(prefix string) ([]oss.OSSPath, error) {
+	start := time.Now()
+	paths, err := m.inner.List(prefix)
+	m.collector.observe(m.inner.Type(), oss.OperationList, start, err)
+	return paths, err
+}
+
+func (m *MetricsStorage) Delete(key string) error {
+	start := time.Now()
+	err := m.inner.Delete(key)
+	m.collector.observe(m.inner.Type(), oss.OperationDelete, start, err)
+	return err
+}
+
+func (m *MetricsStorage) Type() string {
+	return m.inner.Type()
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsStorage(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	registry := prometheus.NewRegistry()
+	collector := NewCollector(Options{Namespace: "dify"})
+	assert.Nil(t, collector.Register(registry))
+
+	storage := NewMetricsStorage(inner, collector)
+	assert.Nil(t, storage.Save("a/b", []byte("hello")))
+	data, err := storage.Load("a/b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	_, err = storage.Load("a/missing")
+	assert.NotNil(t, err)
+
+	localType := oss.OSS_TYPE_LOCAL
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.operations.WithLabelValues(localType, "save", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.operations.WithLabelValues(localType, "load", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.operations.WithLabelValues(localType, "load", "error")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.errors.WithLabelValues(localType, "load", "not_found")))
+	assert.Equal(t, float64(5), testutil.ToFloat64(collector.writtenBytes.WithLabelValues(localType)))
+	assert.Equal(t, float64(5), testutil.ToFloat64(collector.readBytes.WithLabelValues(localType)))
+
+	count, err := testutil.GatherAndCount(registry, "dify_oss_operation_duration_seconds")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,336 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+const (
+	defaultQueueSize   = 1024
+	defaultMaxAttempts = 5
+	defaultRetryDelay  = time.Second
+)
+
+var (
+	// ErrObjectMissing means a backend lacks an object of the primary, or the
+	// primary lacks an object found on a secondary
+	ErrObjectMissing = oss.NewCloudKitError("object missing", "")
+	// ErrSizeMismatch means a secondary stores another size than the primary
+	ErrSizeMismatch = oss.NewCloudKitError("object size mismatch", "")
+	// ErrQueueFull means an asynchronous write was dropped
+	ErrQueueFull = oss.NewCloudKitError("mirror queue full", "")
+	// ErrClosed means an asynchronous write was made after Close, it was
+	// written to the primary only
+	ErrClosed = oss.NewCloudKitError("mirror closed", "")
+)
+
+// Divergence is a difference between the primary and a secondary
+type Divergence struct {
+	Operation oss.Operation
+	Key       string
+	// Secondary is the index of the secondary in the list given to NewMirrorStorage
+	Secondary int
+	Err       error
+}
+
+type Options struct {
+	// Async mirrors the writes through a queue retried in the background,
+	// otherwise Save and Delete return once every secondary is written
+	Async bool
+	// QueueSize is the number of pending writes of every secondary, defaults to 1024
+	QueueSize int
+	// MaxAttempts is the number of attempts of a queued write, defaults to 5
+	MaxAttempts int
+	// RetryDelay is the delay between two attempts of a queued write, defaults to 1s
+	RetryDelay time.Duration
+	// FallbackReads reads from the secondaries when the object is not found on the primary
+	FallbackReads bool
+	// OnDivergence is called for every write which could not be mirrored and
+	// every object read from a secondary
+	OnDivergence func(d Divergence)
+}
+
+type task struct {
+	operation oss.Operation
+	key       string
+	data      []byte
+}
+
+type queue struct {
+	tasks   []chan task
+	pending sync.WaitGroup
+	done    chan struct{}
+	workers sync.WaitGroup
+	once    sync.Once
+
+	// mu orders the enqueued writes with Close, no write is enqueued once
+	// closed is set
+	mu     sync.Mutex
+	closed bool
+}
+
+// MirrorStorage writes to a primary and mirrors the writes to secondaries,
+// reads are served by the primary. A migration is cut over by swapping the
+// primary with a secondary.
+type MirrorStorage struct {
+	primary     oss.OSS
+	secondaries []oss.OSS
+	opts        Options
+	queue       *queue
+}
+
+func NewMirrorStorage(primary oss.OSS, secondaries []oss.OSS, opts Options) *MirrorStorage {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+
+	m := &MirrorStorage{
+		primary:     primary,
+		secondaries: secondaries,
+		opts:        opts,
+	}
+	if opts.Async {
+		m.queue = &queue{done: make(chan struct{})}
+		for i := range secondaries {
+			tasks := make(chan task, opts.QueueSize)
+			m.queue.tasks = append(m.queue.tasks, tasks)
+			m.queue.workers.Add(1)
+			// one worker per secondary keeps the writes of a key in order
+			go m.work(i, tasks)
+		}
+	}
+	return m
+}
+
+func (m *MirrorStorage) diverged(d Divergence) {
+	if m.opts.OnDivergence != nil {
+		m.opts.OnDivergence(d)
+	}
+}
+
+func (m *MirrorStorage) apply(secondary oss.OSS, t task) error {
+	if t.operation == oss.OperationDelete {
+		err := secondary.Delete(t.key)
+		// the object may have never been mirrored
+		if errclass.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return secondary.Save(t.key, t.data)
+}
+
+func (m *MirrorStorage) work(i int, tasks chan task) {
+	defer m.queue.workers.Done()
+	for {
+		select {
+		case t := <-tasks:
+			m.retry(i, t)
+			m.queue.pending.Done()
+		case <-m.queue.done:
+			return
+		}
+	}
+}
+
+func (m *MirrorStorage) retry(i int, t task) {
+	var err error
+	for attempt := 1; attempt <= m.opts.MaxAttempts; attempt++ {
+		err = m.apply(m.secondaries[i], t)
+		if err == nil {
+			return
+		}
+		if attempt < m.opts.MaxAttempts {
+			select {
+			case <-time.After(m.opts.RetryDelay):
+			case <-m.queue.done:
+				attempt = m.opts.MaxAttempts
+			}
+		}
+	}
+	m.diverged(Divergence{Operation: t.operation, Key: t.key, Secondary: i, Err: err})
+}
+
+// mirror applies a write which succeeded on the primary to the secondaries
+func (m *MirrorStorage) mirror(t task) error {
+	if m.queue == nil {
+		var errs []error
+		for i, secondary := range m.secondaries {
+			if err := m.apply(secondary, t); err != nil {
+				m.diverged(Divergence{Operation: t.operation, Key: t.key, Secondary: i, Err: err})
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	if m.queue.closed {
+		for i := range m.queue.tasks {
+			m.diverged(Divergence{Operation: t.operation, Key: t.key, Secondary: i, Err: ErrClosed})
+		}
+		return ErrClosed.Errorf("%s of %q was not mirrored", t.operation, t.key)
+	}
+	// the caller may reuse data once Save returns
+	t.data = bytes.Clone(t.data)
+	for i, tasks := range m.queue.tasks {
+		m.queue.pending.Add(1)
+		select {
+		case tasks <- t:
+		default:
+			m.queue.pending.Done()
+			m.diverged(Divergence{Operation: t.operation, Key: t.key, Secondary: i, Err: ErrQueueFull})
+		}
+	}
+	return nil
+}
+
+// Flush waits until the queued writes are applied or given up
+func (m *MirrorStorage) Flush() {
+	if m.queue != nil {
+		m.queue.pending.Wait()
+	}
+}
+
+// Close flushes the queue and stops the background workers, the writes made
+// afterwards are only written to the primary and return ErrClosed
+func (m *MirrorStorage) Close() error {
+	if m.queue != nil {
+		m.queue.once.Do(func() {
+			m.queue.mu.Lock()
+			m.queue.closed = true
+			m.queue.mu.Unlock()
+			m.Flush()
+			close(m.queue.done)
+			m.queue.workers.Wait()
+		})
+	}
+	return nil
+}
+
+// Compare reports how the secondaries differ from the primary for key
+func (m *MirrorStorage) Compare(key string) ([]Divergence, error) {
+	primary, primaryErr := m.primary.State(key)
+	if primaryErr != nil && !errclass.IsNotFound(primaryErr) {
+		return nil, primaryErr
+	}
+
+	var divergences []Divergence
+	for i, secondary := range m.secondaries {
+		state, err := secondary.State(key)
+		found := err == nil
+		if err != nil && !errclass.IsNotFound(err) {
+			return nil, err
+		}
+		switch {
+		case found != (primaryErr == nil):
+			err = ErrObjectMissing
+		case found && state.Size != primary.Size:
+			err = ErrSizeMismatch
+		default:
+			continue
+		}
+		divergences = append(divergences, Divergence{Operation: oss.OperationState, Key: key, Secondary: i, Err: err})
+	}
+	return divergences, nil
+}
+
+// WithContext returns a copy of the storage whose synchronous requests use
+// ctx, the queued writes are not bound to the context of the caller
+func (m *MirrorStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *m
+	storage.primary = oss.WithContext(ctx, m.primary)
+	// the workers of the queue keep the secondaries without ctx
+	if m.queue == nil {
+		storage.secondaries = make([]oss.OSS, len(m.secondaries))
+		for i, secondary := range m.secondaries {
+			storage.secondaries[i] = oss.WithContext(ctx, secondary)
+		}
+	}
+	return &storage
+}
+
+func (m *MirrorStorage) Unwrap() oss.OSS {
+	return m.primary
+}
+
+// Save returns the error of the primary, a synchronous mirror also returns
+// the errors of the secondaries and a closed asynchronous one ErrClosed
+func (m *MirrorStorage) Save(key string, data []byte) error {
+	if err := m.primary.Save(key, data); err != nil {
+		return err
+	}
+	return m.mirror(task{operation: oss.OperationSave, key: key, data: data})
+}
+
+func (m *MirrorStorage) Delete(key string) error {
+	if err := m.primary.Delete(key); err != nil {
+		return err
+	}
+	return m.mirror(task{operation: oss.OperationDelete, key: key})
+}
+
+// fallback runs read on the secondaries when the primary did not find the object
+func fallback[T any](m *MirrorStorage, op oss.Operation, key string, result T, err error, read func(oss.OSS) (T, error)) (T, error) {
+	if !m.opts.FallbackReads || !errclass.IsNotFound(err) {
+		return result, err
+	}
+	for i, secondary := range m.secondaries {
+		secondaryResult, secondaryErr := read(secondary)
+		if secondaryErr == nil {
+			m.diverged(Divergence{Operation: op, Key: key, Secondary: i, Err: ErrObjectMissing})
+			return secondaryResult, nil
+		}
+	}
+	return result, err
+}
+
+func (m *MirrorStorage) Load(key string) ([]byte, error) {
+	data, err := m.primary.Load(key)
+	return fallback(m, oss.OperationLoad, key, data, err, func(s oss.OSS) ([]byte, error) {
+		return s.Load(key)
+	})
+}
+
+func (m *MirrorStorage) State(key string) (oss.OSSState, error) {
+	state, err := m.primary.State(key)
+	return fallback(m, oss.OperationState, key, state, err, func(s oss.OSS) (oss.OSSState, error) {
+		return s.State(key)
+	})
+}
+
+func (m *MirrorStorage) Exists(key string) (bool, error) {
+	exists, err := m.primary.Exists(key)
+	if err != nil || exists || !m.opts.FallbackReads {
+		return exists, err
+	}
+	for i, secondary := range m.secondaries {
+		if found, err := secondary.Exists(key); err == nil && found {
+			m.diverged(Divergence{Operation: oss.OperationExists, Key: key, Secondary: i, Err: ErrObjectMissing})
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List lists the primary only
+func (m *MirrorStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return m.primary.List(prefix)
+}
+
+func (m *MirrorStorage) Type() string {
+	return m.primary.Type()
+}
@@ -0,0 +1,137 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string       { return "status error" }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+// flakyStorage fails the first saves
+type flakyStorage struct {
+	oss.OSS
+	mu       sync.Mutex
+	failures int
+}
+
+func (f *flakyStorage) Save(key string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return statusError(503)
+	}
+	return f.OSS.Save(key, data)
+}
+
+func TestMirrorSync(t *testing.T) {
+	primary := memory.New()
+	secondary := &flakyStorage{OSS: memory.New()}
+	var divergences []Divergence
+	storage := NewMirrorStorage(primary, []oss.OSS{secondary}, Options{
+		OnDivergence: func(d Divergence) { divergences = append(divergences, d) },
+	})
+
+	assert.Nil(t, storage.Save("a", []byte("a")))
+	data, err := secondary.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+
+	secondary.failures = 1
+	err = storage.Save("b", []byte("bb"))
+	assert.True(t, errors.Is(err, statusError(503)))
+	assert.Equal(t, 1, len(divergences))
+	assert.Equal(t, oss.OperationSave, divergences[0].Operation)
+
+	// the primary has the object anyway
+	exists, _ := primary.Exists("b")
+	assert.True(t, exists)
+
+	compared, err := storage.Compare("b")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(compared))
+	assert.True(t, errors.Is(compared[0].Err, ErrObjectMissing))
+
+	assert.Nil(t, storage.Delete("a"))
+	exists, _ = secondary.Exists("a")
+	assert.False(t, exists)
+}
+
+func TestMirrorAsyncAndFallback(t *testing.T) {
+	primary := memory.New()
+	secondary := &flakyStorage{OSS: memory.New(), failures: 2}
+	storage := NewMirrorStorage(primary, []oss.OSS{secondary}, Options{
+		Async:         true,
+		RetryDelay:    time.Millisecond,
+		FallbackReads: true,
+	})
+	defer storage.Close()
+
+	data := []byte("a")
+	assert.Nil(t, storage.Save("a", data))
+	data[0] = 'x'
+	storage.Flush()
+
+	mirrored, err := secondary.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), mirrored)
+
+	// objects only found on the secondary are read from it
+	assert.Nil(t, secondary.Save("only-secondary", []byte("s")))
+	loaded, err := storage.Load("only-secondary")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("s"), loaded)
+	exists, err := storage.Exists("only-secondary")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestMirrorWritesRacingClose(t *testing.T) {
+	primary := memory.New()
+	secondary := memory.New()
+	storage := NewMirrorStorage(primary, []oss.OSS{secondary}, Options{Async: true})
+
+	errs := make([]error, 50)
+	wg := sync.WaitGroup{}
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = storage.Save(fmt.Sprintf("key-%d", i), []byte("a"))
+		}()
+	}
+	assert.Nil(t, storage.Close())
+	wg.Wait()
+
+	flushed := make(chan struct{})
+	go func() {
+		storage.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("Flush is blocked by a write made after Close")
+	}
+
+	// the writes are either mirrored or rejected
+	for i, err := range errs {
+		exists, _ := secondary.Exists(fmt.Sprintf("key-%d", i))
+		if err != nil {
+			assert.True(t, errors.Is(err, ErrClosed))
+		}
+		assert.Equal(t, err == nil, exists)
+	}
+	err := storage.Save("after", []byte("a"))
+	assert.True(t, errors.Is(err, ErrClosed))
+}
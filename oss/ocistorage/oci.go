@@ -0,0 +1,310 @@
+package ocistorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
+	"github.com/langgenius/dify-cloud-kit/oss/s3"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/objectstorage"
+)
+
+type OCIStorage struct {
+	namespace   string
+	bucket      string
+	compartment string
+	client      objectstorage.ObjectStorageClient
+	ctx         context.Context
+}
+
+// NewOCIStorage creates the storage with the native API, or with the S3
+// compatibility API if UseS3Compat is set
+func NewOCIStorage(args oss.OSSArgs) (oss.OSS, error) {
+	if args.OCIObjectStorage == nil {
+		return nil, oss.ErrArgumentInvalid.WithDetail("can't find OCI Object Storage argument in OSSArgs")
+	}
+
+	err := args.OCIObjectStorage.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if args.OCIObjectStorage.UseS3Compat {
+		return newS3CompatStorage(args.OCIObjectStorage)
+	}
+	return newNativeStorage(args.OCIObjectStorage)
+}
+
+// newS3CompatStorage uses the S3 driver with the quirks of the compatibility
+// API: it only supports path style requests, it's signed with the OCI region
+// and it rejects the checksums the AWS SDK sends by default
+func newS3CompatStorage(args *oss.OCIObjectStorage) (oss.OSS, error) {
+	endpoint := args.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.compat.objectstorage.%s.oraclecloud.com", args.Namespace, args.Region)
+	}
+	return s3.NewS3CompatibleStorage(oss.OSSArgs{
+		S3: &oss.S3{
+			UseAws:               true,
+			Endpoint:             endpoint,
+			UsePathStyle:         true,
+			AccessKey:            args.AccessKey,
+			SecretKey:            args.SecretKey,
+			Bucket:               args.Bucket,
+			Region:               args.Region,
+			ChecksumWhenRequired: true,
+			Prefix:               args.Prefix,
+			Provisioning:         args.Provisioning,
+			Transport:            args.Transport,
+		},
+	}, oss.OSS_TYPE_OCI_STORAGE)
+}
+
+func newNativeStorage(args *oss.OCIObjectStorage) (oss.OSS, error) {
+	var passphrase *string
+	if args.PrivateKeyPassphrase != "" {
+		passphrase = common.String(args.PrivateKeyPassphrase)
+	}
+	provider := common.NewRawConfigurationProvider(
+		args.TenancyID,
+		args.UserID,
+		args.Region,
+		args.Fingerprint,
+		args.PrivateKey,
+		passphrase,
+	)
+	client, err := objectstorage.NewObjectStorageClientWithConfigurationProvider(provider)
+	if err != nil {
+		return nil, oss.ErrProviderInit.WithError(err)
+	}
+	if args.Endpoint != "" {
+		client.Host = args.Endpoint
+	}
+
+	httpClient, err := args.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		client.HTTPClient = httpClient
+	}
+
+	namespace := args.Namespace
+	if namespace == "" {
+		resp, err := client.GetNamespace(context.Background(), objectstorage.GetNamespaceRequest{})
+		if err != nil {
+			return nil, oss.ErrProviderInit.WithError(err).WithDetail("failed to get namespace")
+		}
+		namespace = *resp.Value
+	}
+	compartment := args.CompartmentID
+	if compartment == "" {
+		compartment = args.TenancyID
+	}
+
+	storage := &OCIStorage{
+		namespace:   namespace,
+		bucket:      args.Bucket,
+		compartment: compartment,
+		client:      client,
+		ctx:         context.Background(),
+	}
+	err = storage.EnsureBucket(args.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.Prefix)
+}
+
+// EnsureBucket applies the provisioning to the bucket, a new bucket is
+// created in the compartment and the region of the client. ACL takes the
+// public access types of OCI, private and public-read are accepted too.
+func (s *OCIStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(s.bucket, s.bucketExists, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *OCIStorage) bucketExists() (bool, error) {
+	_, err := s.client.HeadBucket(context.Background(), objectstorage.HeadBucketRequest{
+		NamespaceName: common.String(s.namespace),
+		BucketName:    common.String(s.bucket),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func publicAccessType(acl string) (objectstorage.CreateBucketDetailsPublicAccessTypeEnum, error) {
+	switch acl {
+	case "", "private":
+		return objectstorage.CreateBucketDetailsPublicAccessTypeNopublicaccess, nil
+	case "public-read":
+		return objectstorage.CreateBucketDetailsPublicAccessTypeObjectread, nil
+	}
+	accessType, ok := objectstorage.GetMappingCreateBucketDetailsPublicAccessTypeEnum(acl)
+	if !ok {
+		return "", oss.ErrArgumentInvalid.Errorf("unknown public access type %q", acl)
+	}
+	return accessType, nil
+}
+
+func (s *OCIStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	accessType, err := publicAccessType(provisioning.ACL)
+	if err != nil {
+		return err
+	}
+	details := objectstorage.CreateBucketDetails{
+		Name:             common.String(s.bucket),
+		CompartmentId:    common.String(s.compartment),
+		PublicAccessType: accessType,
+	}
+	if provisioning.Versioning {
+		details.Versioning = objectstorage.CreateBucketDetailsVersioningEnabled
+	}
+	_, err = s.client.CreateBucket(context.Background(), objectstorage.CreateBucketRequest{
+		NamespaceName:       common.String(s.namespace),
+		CreateBucketDetails: details,
+	})
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *OCIStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
+func isNotFound(err error) bool {
+	var ociErr common.ServiceError
+	return errors.As(err, &ociErr) && ociErr.GetHTTPStatusCode() == http.StatusNotFound
+}
+
+func (s *OCIStorage) Save(key string, data []byte) error {
+	_, err := s.client.PutObject(s.ctx, objectstorage.PutObjectRequest{
+		NamespaceName: common.String(s.namespace),
+		BucketName:    common.String(s.bucket),
+		ObjectName:    common.String(key),
+		ContentLength: common.Int64(int64(len(data))),
+		PutObjectBody: io.NopCloser(bytes.NewReader(data)),
+	})
+	return err
+}
+
+func (s *OCIStorage) Load(key string) ([]byte, error) {
+	resp, err := s.client.GetObject(s.ctx, objectstorage.GetObjectRequest{
+		NamespaceName: common.String(s.namespace),
+		BucketName:    common.String(s.bucket),
+		ObjectName:    common.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Content.Close()
+	return io.ReadAll(resp.Content)
+}
+
+func (s *OCIStorage) head(key string) (objectstorage.HeadObjectResponse, error) {
+	return s.client.HeadObject(s.ctx, objectstorage.HeadObjectRequest{
+		NamespaceName: common.String(s.namespace),
+		BucketName:    common.String(s.bucket),
+		ObjectName:    common.String(key),
+	})
+}
+
+func (s *OCIStorage) Exists(key string) (bool, error) {
+	_, err := s.head(key)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *OCIStorage) State(key string) (oss.OSSState, error) {
+	resp, err := s.head(key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	state := oss.OSSState{}
+	if resp.ContentLength != nil {
+		state.Size = *resp.ContentLength
+	}
+	if resp.LastModified != nil {
+		state.LastModified = resp.LastModified.Time
+	}
+	if resp.ETag != nil {
+		state.ETag = *resp.ETag
+	}
+	return state, nil
+}
+
+func (s *OCIStorage) List(prefix string) ([]oss.OSSPath, error) {
+	// append a slash to the prefix if it doesn't end with one, an empty prefix lists the bucket
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	var keys []oss.OSSPath
+	var start *string
+	for {
+		resp, err := s.client.ListObjects(s.ctx, objectstorage.ListObjectsRequest{
+			NamespaceName: common.String(s.namespace),
+			BucketName:    common.String(s.bucket),
+			Prefix:        common.String(prefix),
+			Start:         start,
+			Limit:         common.Int(1000),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Objects {
+			// remove prefix
+			key := strings.TrimPrefix(*obj.Name, prefix)
+			// remove leading slash
+			key = strings.TrimPrefix(key, "/")
+			if key == "" {
+				continue
+			}
+			keys = append(keys, oss.OSSPath{
+				Path:  key,
+				IsDir: false,
+			})
+		}
+		if resp.NextStartWith == nil || *resp.NextStartWith == "" {
+			break
+		}
+		start = resp.NextStartWith
+	}
+	return keys, nil
+}
+
+// Delete succeeds if the object does not exist
+func (s *OCIStorage) Delete(key string) error {
+	_, err := s.client.DeleteObject(s.ctx, objectstorage.DeleteObjectRequest{
+		NamespaceName: common.String(s.namespace),
+		BucketName:    common.String(s.bucket),
+		ObjectName:    common.String(key),
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *OCIStorage) Type() string {
+	return oss.OSS_TYPE_OCI_STORAGE
+}
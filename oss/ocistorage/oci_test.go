@@ -0,0 +1,264 @@
+package ocistorage
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/stretchr/testify/assert"
+)
+
+var modified = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fakeOCI serves the native object storage API for a single bucket, the
+// listing is paginated by two objects
+type fakeOCI struct {
+	mu      sync.Mutex
+	exists  bool
+	created map[string]any
+	objects map[string][]byte
+}
+
+func (f *fakeOCI) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": code})
+}
+
+func (f *fakeOCI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") == "" {
+		f.fail(w, http.StatusUnauthorized, "NotAuthenticated")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/n/" || r.URL.Path == "/n":
+		json.NewEncoder(w).Encode("tenant")
+		return
+	case r.URL.Path == "/n/tenant/b/" || r.URL.Path == "/n/tenant/b":
+		json.NewDecoder(r.Body).Decode(&f.created)
+		f.exists = true
+		json.NewEncoder(w).Encode(f.created)
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/n/tenant/b/dify")
+	if !ok || !f.exists {
+		f.fail(w, http.StatusNotFound, "BucketNotFound")
+		return
+	}
+	if rest == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if rest == "/o" || rest == "/o/" {
+		f.list(w, r)
+		return
+	}
+
+	key := strings.TrimPrefix(rest, "/o/")
+	data, ok := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		w.Header().Set("ETag", "etag-"+key)
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			f.fail(w, http.StatusNotFound, "ObjectNotFound")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		w.Header().Set("ETag", "etag-"+key)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		if !ok {
+			f.fail(w, http.StatusNotFound, "ObjectNotFound")
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeOCI) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	start := r.URL.Query().Get("start")
+	var names []string
+	for name := range f.objects {
+		if strings.HasPrefix(name, prefix) && name >= start {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := map[string]any{}
+	if len(names) > 2 {
+		result["nextStartWith"] = names[2]
+		names = names[:2]
+	}
+	objects := []map[string]any{}
+	for _, name := range names {
+		objects = append(objects, map[string]any{"name": name, "size": len(f.objects[name])})
+	}
+	result["objects"] = objects
+	json.NewEncoder(w).Encode(result)
+}
+
+func privateKey(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func newNativeArgs(t *testing.T, fake http.Handler) *oss.OCIObjectStorage {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return &oss.OCIObjectStorage{
+		Region:      "us-ashburn-1",
+		Bucket:      "dify",
+		Endpoint:    server.URL,
+		TenancyID:   "ocid1.tenancy.oc1..tenancy",
+		UserID:      "ocid1.user.oc1..user",
+		Fingerprint: "aa:bb",
+		PrivateKey:  privateKey(t),
+	}
+}
+
+func TestOCIStorage(t *testing.T) {
+	fake := &fakeOCI{exists: true, objects: map[string][]byte{}}
+	storage, err := NewOCIStorage(oss.OSSArgs{OCIObjectStorage: newNativeArgs(t, fake)})
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSS_TYPE_OCI_STORAGE, storage.Type())
+
+	exists, err := storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = storage.Load("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+
+	for _, key := range []string{"plugins/a.pkg", "plugins/b.pkg", "plugins/c/d.pkg", "pluginsx"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("plugins/a.pkg"), data)
+
+	state, err := storage.State("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSSState{Size: 13, LastModified: modified, ETag: "etag-plugins/a.pkg"}, oss.OSSState{
+		Size:         state.Size,
+		LastModified: state.LastModified.UTC(),
+		ETag:         state.ETag,
+	})
+
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "b.pkg"}, {Path: "c/d.pkg"}}, paths)
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	exists, err = storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestOCIProvisioning(t *testing.T) {
+	fake := &fakeOCI{objects: map[string][]byte{}}
+	args := newNativeArgs(t, fake)
+	args.CompartmentID = "ocid1.compartment.oc1..dify"
+	args.Provisioning = oss.BucketProvisioning{
+		Policy:     oss.BucketPolicyCreateIfMissing,
+		ACL:        "public-read",
+		Versioning: true,
+	}
+
+	_, err := NewOCIStorage(oss.OSSArgs{OCIObjectStorage: args})
+	assert.Nil(t, err)
+	assert.True(t, fake.exists)
+	assert.Equal(t, "dify", fake.created["name"])
+	assert.Equal(t, "ocid1.compartment.oc1..dify", fake.created["compartmentId"])
+	assert.Equal(t, "ObjectRead", fake.created["publicAccessType"])
+	assert.Equal(t, "Enabled", fake.created["versioning"])
+
+	args.Provisioning.ACL = "world"
+	fake.exists = false
+	_, err = NewOCIStorage(oss.OSSArgs{OCIObjectStorage: args})
+	assert.NotNil(t, err)
+}
+
+func TestOCIS3Compat(t *testing.T) {
+	objects := map[string][]byte{}
+	mu := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the compatibility API rejects the checksums sent by default
+		for name := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), "x-amz-checksum") || strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "/us-ashburn-1/s3/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/dify/")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			w.Write(objects[key])
+		}
+	}))
+	defer server.Close()
+
+	storage, err := NewOCIStorage(oss.OSSArgs{OCIObjectStorage: &oss.OCIObjectStorage{
+		Region:      "us-ashburn-1",
+		Namespace:   "tenant",
+		Bucket:      "dify",
+		Endpoint:    server.URL,
+		UseS3Compat: true,
+		AccessKey:   "ak",
+		SecretKey:   "sk",
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSS_TYPE_OCI_STORAGE, storage.Type())
+
+	assert.Nil(t, storage.Save("plugins/a.pkg", []byte("data")))
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
+
+func TestOCIValidate(t *testing.T) {
+	_, err := NewOCIStorage(oss.OSSArgs{OCIObjectStorage: &oss.OCIObjectStorage{Region: "us-ashburn-1", Bucket: "dify"}})
+	assert.NotNil(t, err)
+	_, err = NewOCIStorage(oss.OSSArgs{OCIObjectStorage: &oss.OCIObjectStorage{Region: "us-ashburn-1", Bucket: "dify", UseS3Compat: true}})
+	assert.NotNil(t, err)
+}
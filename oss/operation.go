@@ -0,0 +1,28 @@
+package oss
+
+// Operation names a method of OSS, wrappers use it for labels, rules and budgets
+type Operation string
+
+const (
+	OperationSave   Operation = "save"
+	OperationLoad   Operation = "load"
+	OperationExists Operation = "exists"
+	OperationState  Operation = "state"
+	OperationList   Operation = "list"
+	OperationDelete Operation = "delete"
+)
+
+// Operations lists all the operations of OSS
+var Operations = []Operation{
+	OperationSave,
+	OperationLoad,
+	OperationExists,
+	OperationState,
+	OperationList,
+	OperationDelete,
+}
+
+// IsMutation reports whether the operation changes the stored data
+func (o Operation) IsMutation() bool {
+	return o == OperationSave || o == OperationDelete
+}
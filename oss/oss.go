@@ -2,6 +2,7 @@ package oss
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -17,11 +18,19 @@ const (
 	OSS_TYPE_ALIYUN_OSS     = "aliyun_oss"
 	OSS_TYPE_HUAWEI_OBS     = "huawei_obs"
 	OSS_TYPE_VOLCENGINE_TOS = "volcengine_tos"
+	OSS_TYPE_MEMORY         = "memory"
+	OSS_TYPE_BAIDU_BOS      = "baidu_bos"
+	OSS_TYPE_OCI_STORAGE    = "oci_storage"
+	OSS_TYPE_SUPABASE       = "supabase"
+	OSS_TYPE_SWIFT          = "openstack_swift"
+	OSS_TYPE_WEBDAV         = "webdav"
 )
 
 type OSSState struct {
 	Size         int64
 	LastModified time.Time
+	// ETag identifies the content of the object, it's empty if the storage has none
+	ETag string
 }
 
 type OSSPath struct {
@@ -56,6 +65,12 @@ type OSSArgs struct {
 	GoogleCloudStorage *GoogleCloudStorage
 	HuaweiOBS          *HuaweiOBS
 	VolcengineTOS      *VolcengineTOS
+	Memory             *Memory
+	BaiduBOS           *BaiduBOS
+	OCIObjectStorage   *OCIObjectStorage
+	Supabase           *Supabase
+	OpenStackSwift     *OpenStackSwift
+	WebDAV             *WebDAV
 }
 
 type S3 struct {
@@ -68,6 +83,12 @@ type S3 struct {
 	Region           string
 	UseIamRole       bool
 	SignatureVersion string
+	// ChecksumWhenRequired only sends and validates checksums when the operation
+	// requires them, some S3 compatible services reject the default checksums
+	ChecksumWhenRequired bool
+	Prefix               string
+	Provisioning         BucketProvisioning
+	Transport            *Transport
 }
 
 func (s *S3) Validate() error {
@@ -75,12 +96,19 @@ func (s *S3) Validate() error {
 		msg := fmt.Sprintf("bucket and region cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := s.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return s.Provisioning.Validate()
 }
 
 type AzureBlob struct {
 	ConnectionString string
 	ContainerName    string
+	Prefix           string
+	Provisioning     BucketProvisioning
+	Transport        *Transport
 }
 
 func (a *AzureBlob) Validate() error {
@@ -88,7 +116,11 @@ func (a *AzureBlob) Validate() error {
 		msg := fmt.Sprintf("connectorString and containerName cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := a.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return a.Provisioning.Validate()
 }
 
 type Local struct {
@@ -102,15 +134,26 @@ func (l *Local) Validate() error {
 	return nil
 }
 
+type Memory struct {
+	// Now returns the LastModified of the saved objects, defaults to time.Now
+	Now func() time.Time
+}
+
+func (m *Memory) Validate() error {
+	return nil
+}
+
 type AliyunOSS struct {
-	Region      string
-	Endpoint    string
-	AccessKey   string
-	SecretKey   string
-	AuthVersion string
-	Path        string
-	Bucket      string
-	CloudBoxId  string
+	Region       string
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	AuthVersion  string
+	Path         string
+	Bucket       string
+	CloudBoxId   string
+	Provisioning BucketProvisioning
+	Transport    *Transport
 }
 
 func (a *AliyunOSS) Validate() error {
@@ -118,15 +161,22 @@ func (a *AliyunOSS) Validate() error {
 		msg := fmt.Sprintf("bucket, accesskKey, secretKey, endpoint cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := a.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return a.Provisioning.Validate()
 }
 
 type TencentCOS struct {
-	Region    string
-	SecretID  string
-	SecretKey string
-	Bucket    string
-	Endpoint  string
+	Region       string
+	SecretID     string
+	SecretKey    string
+	Bucket       string
+	Endpoint     string
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
 }
 
 func (t *TencentCOS) Validate() error {
@@ -134,12 +184,19 @@ func (t *TencentCOS) Validate() error {
 		msg := fmt.Sprintf("bucket, region, secretKey, secretID cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := t.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return t.Provisioning.Validate()
 }
 
 type GoogleCloudStorage struct {
 	Bucket         string
 	CredentialsB64 string
+	Prefix         string
+	Provisioning   BucketProvisioning
+	Transport      *Transport
 }
 
 func (g *GoogleCloudStorage) Validate() error {
@@ -147,15 +204,22 @@ func (g *GoogleCloudStorage) Validate() error {
 		msg := fmt.Sprintf("bucket and credentials cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := g.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return g.Provisioning.Validate()
 }
 
 type HuaweiOBS struct {
-	Bucket    string
-	AccessKey string
-	SecretKey string
-	Server    string
-	PathStyle bool
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	Server       string
+	PathStyle    bool
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
 }
 
 func (h *HuaweiOBS) Validate() error {
@@ -163,15 +227,22 @@ func (h *HuaweiOBS) Validate() error {
 		msg := fmt.Sprintf("bucket, accesskKey, secretKey, server cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := h.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return h.Provisioning.Validate()
 }
 
 type VolcengineTOS struct {
-	Region    string
-	Endpoint  string
-	AccessKey string
-	SecretKey string
-	Bucket    string
+	Region       string
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	Bucket       string
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
 }
 
 func (t *VolcengineTOS) Validate() error {
@@ -179,5 +250,182 @@ func (t *VolcengineTOS) Validate() error {
 		msg := fmt.Sprintf("bucket, endpoint,accessKey, secretKey cannot be empty.")
 		return ErrArgumentInvalid.WithDetail(msg)
 	}
-	return nil
+	err := t.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return t.Provisioning.Validate()
+}
+
+type BaiduBOS struct {
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	Bucket       string
+	PathStyle    bool
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
+}
+
+func (b *BaiduBOS) Validate() error {
+	if b.Bucket == "" || b.AccessKey == "" || b.SecretKey == "" || b.Endpoint == "" {
+		msg := fmt.Sprintf("bucket, accessKey, secretKey, endpoint cannot be empty.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	err := b.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return b.Provisioning.Validate()
+}
+
+type OCIObjectStorage struct {
+	Region    string
+	Namespace string
+	Bucket    string
+	// Endpoint replaces the endpoint of the region
+	Endpoint string
+
+	// TenancyID, UserID, Fingerprint and PrivateKey are the API key of the native API
+	TenancyID            string
+	UserID               string
+	Fingerprint          string
+	PrivateKey           string
+	PrivateKeyPassphrase string
+	// CompartmentID is where the bucket is created, defaults to the tenancy
+	CompartmentID string
+
+	// UseS3Compat uses the S3 compatibility API with a customer secret key
+	UseS3Compat bool
+	AccessKey   string
+	SecretKey   string
+
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
+}
+
+func (o *OCIObjectStorage) Validate() error {
+	if o.Bucket == "" || o.Region == "" {
+		msg := fmt.Sprintf("bucket and region cannot be empty.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	if o.UseS3Compat {
+		if o.Namespace == "" || o.AccessKey == "" || o.SecretKey == "" {
+			msg := fmt.Sprintf("namespace, accessKey, secretKey cannot be empty with the S3 compatibility API.")
+			return ErrArgumentInvalid.WithDetail(msg)
+		}
+	} else if o.TenancyID == "" || o.UserID == "" || o.Fingerprint == "" || o.PrivateKey == "" {
+		msg := fmt.Sprintf("tenancyID, userID, fingerprint, privateKey cannot be empty.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	err := o.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return o.Provisioning.Validate()
+}
+
+type Supabase struct {
+	// URL is the url of the project, e.g. https://<project>.supabase.co
+	URL          string
+	ServiceKey   string
+	Bucket       string
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
+}
+
+func (s *Supabase) Validate() error {
+	if s.URL == "" || s.ServiceKey == "" || s.Bucket == "" {
+		msg := fmt.Sprintf("url, serviceKey, bucket cannot be empty.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	if _, err := url.Parse(s.URL); err != nil {
+		return ErrArgumentInvalid.WithError(err).WithDetail("url is invalid")
+	}
+	err := s.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return s.Provisioning.Validate()
+}
+
+type OpenStackSwift struct {
+	// AuthURL is the Keystone v3 endpoint, e.g. https://keystone.example.com/v3
+	AuthURL       string
+	UserName      string
+	Password      string
+	UserDomain    string
+	Project       string
+	ProjectDomain string
+	// Region selects the object-store endpoint of the catalog, EndpointType is
+	// public, internal or admin and defaults to public
+	Region       string
+	EndpointType string
+	Container    string
+
+	// objects larger than LargeObjectThreshold are uploaded as static large
+	// objects in segments of SegmentSize, they default to 1GiB and 100MiB
+	LargeObjectThreshold int64
+	SegmentSize          int64
+
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
+}
+
+func (o *OpenStackSwift) Validate() error {
+	// an unscoped token has no catalog, so the project is required too
+	if o.AuthURL == "" || o.UserName == "" || o.Password == "" || o.Project == "" || o.Container == "" {
+		msg := fmt.Sprintf("authURL, userName, password, project, container cannot be empty.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	switch o.EndpointType {
+	case "", "public", "internal", "admin":
+	default:
+		msg := fmt.Sprintf("unknown endpoint type %q", o.EndpointType)
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	if o.LargeObjectThreshold < 0 || o.SegmentSize < 0 {
+		msg := fmt.Sprintf("largeObjectThreshold and segmentSize cannot be negative.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	err := o.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return o.Provisioning.Validate()
+}
+
+type WebDAV struct {
+	// Endpoint is the url of the root collection, e.g. https://nas.local/dav/dify/
+	Endpoint string
+	// Username and Password are sent with basic auth if Username is set
+	Username     string
+	Password     string
+	Prefix       string
+	Provisioning BucketProvisioning
+	Transport    *Transport
+}
+
+func (w *WebDAV) Validate() error {
+	if w.Endpoint == "" {
+		msg := fmt.Sprintf("endpoint cannot be empty.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	u, err := url.Parse(w.Endpoint)
+	if err != nil {
+		return ErrArgumentInvalid.WithError(err).WithDetail("endpoint is invalid")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		msg := fmt.Sprintf("endpoint must be an http or https url.")
+		return ErrArgumentInvalid.WithDetail(msg)
+	}
+	err = w.Transport.Validate()
+	if err != nil {
+		return err
+	}
+	return w.Provisioning.Validate()
 }
@@ -0,0 +1,234 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+// Permission is a set of allowed operations
+type Permission uint8
+
+const (
+	// Read allows Load, Exists and State
+	Read Permission = 1 << iota
+	// List allows List
+	List
+	// Write allows Save
+	Write
+	// Delete allows Delete
+	Delete
+
+	None     Permission = 0
+	ReadOnly            = Read | List
+	All                 = Read | List | Write | Delete
+)
+
+var names = []struct {
+	permission Permission
+	name       string
+}{
+	{Read, "read"},
+	{List, "list"},
+	{Write, "write"},
+	{Delete, "delete"},
+}
+
+func (p Permission) String() string {
+	var parts []string
+	for _, n := range names {
+		if p&n.permission != 0 {
+			parts = append(parts, n.name)
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, "|")
+}
+
+// Has reports whether every permission of required is in p
+func (p Permission) Has(required Permission) bool {
+	return p&required == required
+}
+
+// required returns the permission needed by an operation
+func required(op oss.Operation) Permission {
+	switch op {
+	case oss.OperationSave:
+		return Write
+	case oss.OperationDelete:
+		return Delete
+	case oss.OperationList:
+		return List
+	default:
+		return Read
+	}
+}
+
+// Error is returned for the operations which are not allowed, it matches fs.ErrPermission
+type Error struct {
+	Operation oss.Operation
+	Key       string
+	Required  Permission
+	Granted   Permission
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("permission denied: %s of %q requires %s, granted %s", e.Operation, e.Key, e.Required, e.Granted)
+}
+
+func (e *Error) Unwrap() error {
+	return fs.ErrPermission
+}
+
+type Options struct {
+	// Default is granted for the keys which match none of the prefixes
+	Default Permission
+	// Prefixes grants permissions by key prefix, the longest matching prefix wins
+	Prefixes map[string]Permission
+}
+
+// PermissionStorage rejects the operations which are not granted with an
+// *Error, so a subsystem can be handed a least-privilege storage
+type PermissionStorage struct {
+	inner oss.OSS
+	opts  Options
+}
+
+func NewPermissionStorage(inner oss.OSS, opts Options) *PermissionStorage {
+	return &PermissionStorage{
+		inner: inner,
+		opts:  opts,
+	}
+}
+
+// NewReadOnlyStorage returns a storage which allows reading and listing only
+func NewReadOnlyStorage(inner oss.OSS) *PermissionStorage {
+	return NewPermissionStorage(inner, Options{Default: ReadOnly})
+}
+
+// Granted returns the permission of key, nothing is granted for the keys
+// rejected by oss.ValidateKey
+func (p *PermissionStorage) Granted(key string) Permission {
+	if oss.ValidateKey(key) != nil {
+		return None
+	}
+	granted := p.opts.Default
+	matched := -1
+	for prefix, permission := range p.opts.Prefixes {
+		if len(prefix) > matched && strings.HasPrefix(key, prefix) {
+			granted = permission
+			matched = len(prefix)
+		}
+	}
+	return granted
+}
+
+func (p *PermissionStorage) check(op oss.Operation, key string) error {
+	if err := oss.ValidateKey(key); err != nil {
+		return err
+	}
+	granted := p.Granted(key)
+	if !granted.Has(required(op)) {
+		return &Error{
+			Operation: op,
+			Key:       key,
+			Required:  required(op),
+			Granted:   granted,
+		}
+	}
+	return nil
+}
+
+func (p *PermissionStorage) WithContext(ctx context.Context) oss.OSS {
+	return &PermissionStorage{
+		inner: oss.WithContext(ctx, p.inner),
+		opts:  p.opts,
+	}
+}
+
+func (p *PermissionStorage) Unwrap() oss.OSS {
+	return p.inner
+}
+
+func (p *PermissionStorage) Save(key string, data []byte) error {
+	if err := p.check(oss.OperationSave, key); err != nil {
+		return err
+	}
+	return p.inner.Save(key, data)
+}
+
+func (p *PermissionStorage) Load(key string) ([]byte, error) {
+	if err := p.check(oss.OperationLoad, key); err != nil {
+		return nil, err
+	}
+	return p.inner.Load(key)
+}
+
+func (p *PermissionStorage) Exists(key string) (bool, error) {
+	if err := p.check(oss.OperationExists, key); err != nil {
+		return false, err
+	}
+	return p.inner.Exists(key)
+}
+
+func (p *PermissionStorage) State(key string) (oss.OSSState, error) {
+	if err := p.check(oss.OperationState, key); err != nil {
+		return oss.OSSState{}, err
+	}
+	return p.inner.State(key)
+}
+
+// List is checked against the permission of prefix, the paths below it
+// which can't be listed are left out of the result. "/" lists the root.
+func (p *PermissionStorage) List(prefix string) ([]oss.OSSPath, error) {
+	if prefix == "/" {
+		prefix = ""
+	}
+	if err := p.check(oss.OperationList, prefix); err != nil {
+		return nil, err
+	}
+	// the listing covers prefix as a directory too
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		if err := p.check(oss.OperationList, prefix+"/"); err != nil {
+			return nil, err
+		}
+	}
+	paths, err := p.inner.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(prefix, "/")
+	if base != "" {
+		base += "/"
+	}
+	allowed := make([]oss.OSSPath, 0, len(paths))
+	for _, path := range paths {
+		key := base + path.Path
+		if !p.Granted(key).Has(List) {
+			continue
+		}
+		// a directory is hidden when the prefix of its content is not granted
+		if path.IsDir && !p.Granted(key+"/").Has(List) {
+			continue
+		}
+		allowed = append(allowed, path)
+	}
+	return allowed, nil
+}
+
+func (p *PermissionStorage) Delete(key string) error {
+	if err := p.check(oss.OperationDelete, key); err != nil {
+		return err
+	}
+	return p.inner.Delete(key)
+}
+
+func (p *PermissionStorage) Type() string {
+	return p.inner.Type()
+}
@@ -0,0 +1,101 @@
+package permission
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyStorage(t *testing.T) {
+	inner := memory.New()
+	assert.Nil(t, inner.Save("plugins/a.pkg", []byte("a")))
+	storage := NewReadOnlyStorage(inner)
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(paths))
+
+	err = storage.Delete("plugins/a.pkg")
+	var permissionErr *Error
+	assert.True(t, errors.As(err, &permissionErr))
+	assert.Equal(t, oss.OperationDelete, permissionErr.Operation)
+	assert.Equal(t, Delete, permissionErr.Required)
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+	assert.Equal(t, errclass.Permission, errclass.Classify(err))
+
+	assert.NotNil(t, storage.Save("plugins/b.pkg", []byte("b")))
+	exists, _ := inner.Exists("plugins/a.pkg")
+	assert.True(t, exists)
+}
+
+func TestPermissionPrefixes(t *testing.T) {
+	storage := NewPermissionStorage(memory.New(), Options{
+		Default: None,
+		Prefixes: map[string]Permission{
+			"cache/":          All,
+			"cache/readonly/": ReadOnly,
+		},
+	})
+
+	assert.Nil(t, storage.Save("cache/a", []byte("a")))
+	assert.Nil(t, storage.Delete("cache/a"))
+	assert.NotNil(t, storage.Save("cache/readonly/a", []byte("a")))
+	_, err := storage.Exists("cache/readonly/a")
+	assert.Nil(t, err)
+	_, err = storage.Load("other")
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+
+	assert.Equal(t, "read|list", ReadOnly.String())
+	assert.Equal(t, "none", None.String())
+}
+
+func TestPermissionListFiltersUngranted(t *testing.T) {
+	// the local storage lists the directories too
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	for _, key := range []string{"public/a", "public/secret/b", "secret/c", "d"} {
+		assert.Nil(t, inner.Save(key, []byte(key)))
+	}
+	storage := NewPermissionStorage(inner, Options{
+		Default: ReadOnly,
+		Prefixes: map[string]Permission{
+			"secret/":        None,
+			"public/secret/": None,
+		},
+	})
+
+	paths, err := storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "d"}, {Path: "public", IsDir: true}, {Path: "public/a"}}, paths)
+	paths, err = storage.List("public/")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a"}}, paths)
+	_, err = storage.List("secret")
+	assert.NotNil(t, err)
+}
+
+func TestPermissionRejectsDotSegments(t *testing.T) {
+	inner := memory.New()
+	assert.Nil(t, inner.Save("secret", []byte("x")))
+	storage := NewPermissionStorage(inner, Options{
+		Default:  None,
+		Prefixes: map[string]Permission{"public": All},
+	})
+
+	for _, key := range []string{"public/../secret", "public/./a", "/public/a", "public\\..\\secret"} {
+		_, err := storage.Load(key)
+		assert.True(t, errors.Is(err, oss.ErrArgumentInvalid), key)
+		assert.Equal(t, None, storage.Granted(key), key)
+	}
+	_, err := storage.List("public/..")
+	assert.NotNil(t, err)
+}
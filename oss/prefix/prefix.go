@@ -0,0 +1,146 @@
+package prefix
+
+import (
+	"context"
+	"strings"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+// PrefixStorage scopes a storage to the keys under a root, so environments
+// or tenants can share one bucket. The root is prepended to every key, List
+// results are already relative to the listed prefix so they are returned as
+// they are. Keys which would escape the root are rejected.
+type PrefixStorage struct {
+	inner oss.OSS
+	root  string
+}
+
+func NewPrefixStorage(inner oss.OSS, root string) (*PrefixStorage, error) {
+	root = strings.Trim(root, "/")
+	if root == "" {
+		return nil, oss.ErrArgumentInvalid.Errorf("prefix cannot be empty")
+	}
+	if err := oss.ValidateKey(root); err != nil {
+		return nil, err
+	}
+	return &PrefixStorage{
+		inner: inner,
+		root:  root,
+	}, nil
+}
+
+// Wrap scopes inner to root, inner is returned as it is if root is empty
+func Wrap(inner oss.OSS, root string) (oss.OSS, error) {
+	if strings.Trim(root, "/") == "" {
+		return inner, nil
+	}
+	storage, err := NewPrefixStorage(inner, root)
+	if err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+func (p *PrefixStorage) key(key string) (string, error) {
+	if key == "" {
+		return "", oss.ErrArgumentInvalid.Errorf("key cannot be empty")
+	}
+	if err := oss.ValidateKey(key); err != nil {
+		return "", err
+	}
+	return p.root + "/" + key, nil
+}
+
+// Root returns the prefix of the keys
+func (p *PrefixStorage) Root() string {
+	return p.root
+}
+
+func (p *PrefixStorage) WithContext(ctx context.Context) oss.OSS {
+	return &PrefixStorage{
+		inner: oss.WithContext(ctx, p.inner),
+		root:  p.root,
+	}
+}
+
+func (p *PrefixStorage) Unwrap() oss.OSS {
+	return p.inner
+}
+
+// EnsureBucket applies the provisioning to the bucket of the wrapped storage
+func (p *PrefixStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	ensurer, ok := p.inner.(oss.BucketEnsurer)
+	if !ok {
+		return oss.ErrArgumentInvalid.Errorf("[ %s ] does not support bucket provisioning", p.inner.Type())
+	}
+	return ensurer.EnsureBucket(provisioning)
+}
+
+func (p *PrefixStorage) Save(key string, data []byte) error {
+	key, err := p.key(key)
+	if err != nil {
+		return err
+	}
+	return p.inner.Save(key, data)
+}
+
+func (p *PrefixStorage) Load(key string) ([]byte, error) {
+	key, err := p.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return p.inner.Load(key)
+}
+
+func (p *PrefixStorage) Exists(key string) (bool, error) {
+	key, err := p.key(key)
+	if err != nil {
+		return false, err
+	}
+	return p.inner.Exists(key)
+}
+
+func (p *PrefixStorage) State(key string) (oss.OSSState, error) {
+	key, err := p.key(key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	return p.inner.State(key)
+}
+
+// List lists the whole root when prefix is empty or "/"
+func (p *PrefixStorage) List(prefix string) ([]oss.OSSPath, error) {
+	if prefix == "" || prefix == "/" {
+		return p.inner.List(p.root)
+	}
+	prefix, err := p.key(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return p.inner.List(prefix)
+}
+
+// ListDir lists one level below prefix of the wrapped storage
+func (p *PrefixStorage) ListDir(prefix string) ([]oss.OSSPath, error) {
+	if prefix == "" || prefix == "/" {
+		return oss.ListDir(p.inner, p.root)
+	}
+	prefix, err := p.key(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return oss.ListDir(p.inner, prefix)
+}
+
+func (p *PrefixStorage) Delete(key string) error {
+	key, err := p.key(key)
+	if err != nil {
+		return err
+	}
+	return p.inner.Delete(key)
+}
+
+func (p *PrefixStorage) Type() string {
+	return p.inner.Type()
+}
@@ -0,0 +1,112 @@
+package prefix
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixStorage(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	tenantA, err := Wrap(inner, "/tenant-a/")
+	assert.Nil(t, err)
+	tenantB, err := Wrap(inner, "tenant-b")
+	assert.Nil(t, err)
+
+	assert.Nil(t, tenantA.Save("plugins/a.pkg", []byte("a")))
+	assert.Nil(t, tenantB.Save("plugins/b.pkg", []byte("b")))
+
+	data, err := inner.Load("tenant-a/plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+
+	exists, err := tenantA.Exists("plugins/b.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	paths, err := tenantA.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}}, paths)
+
+	paths, err = tenantB.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "plugins", IsDir: true}, {Path: "plugins/b.pkg"}}, paths)
+
+	assert.Nil(t, tenantA.Delete("plugins/a.pkg"))
+	exists, _ = inner.Exists("tenant-a/plugins/a.pkg")
+	assert.False(t, exists)
+}
+
+func TestPrefixStorageRejectsEscapes(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	assert.Nil(t, inner.Save("secret", []byte("x")))
+
+	storage, err := NewPrefixStorage(inner, "tenant-a")
+	assert.Nil(t, err)
+
+	for _, key := range []string{"../secret", "a/../../secret", "/secret", "./a", "a\\..\\..\\secret", ""} {
+		_, err := storage.Load(key)
+		assert.True(t, errors.Is(err, oss.ErrArgumentInvalid), key)
+	}
+	_, err = storage.List("..")
+	assert.NotNil(t, err)
+
+	_, err = NewPrefixStorage(inner, "a/../b")
+	assert.NotNil(t, err)
+	unwrapped, err := Wrap(inner, "")
+	assert.Nil(t, err)
+	assert.Equal(t, inner, unwrapped)
+}
+
+func TestPrefixStorageConcurrentRejects(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	storage, err := NewPrefixStorage(inner, "tenant-a")
+	assert.Nil(t, err)
+
+	// the rejected keys get their own errors, the shared sentinel is untouched
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("../secret-%d", i)
+			for j := 0; j < 100; j++ {
+				_, err := storage.Load(key)
+				assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+				assert.Contains(t, err.Error(), key)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPrefixStorageListDir(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+	storage, err := Wrap(inner, "tenant")
+	assert.Nil(t, err)
+
+	for _, key := range []string{"plugins/a.pkg", "plugins/c/d.pkg", "plugins/c/e/f.pkg", "root.pkg"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+
+	// the local storage has no ListDir, the listing is folded to one level
+	paths, err := oss.ListDir(storage, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "plugins", IsDir: true}, {Path: "root.pkg"}}, paths)
+	paths, err = oss.ListDir(storage, "plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "c", IsDir: true}}, paths)
+
+	_, err = oss.ListDir(storage, "../other")
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+}
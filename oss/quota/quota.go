@@ -0,0 +1,350 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+// Usage is what a tenant stores
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// Limit caps the usage of a tenant, the zero value of a field means unlimited
+type Limit struct {
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+func (l Limit) allows(usage Usage) bool {
+	if l.MaxBytes > 0 && usage.Bytes > l.MaxBytes {
+		return false
+	}
+	if l.MaxObjects > 0 && usage.Objects > l.MaxObjects {
+		return false
+	}
+	return true
+}
+
+// Error is returned by the saves which would exceed the limit of the tenant
+type Error struct {
+	Tenant string
+	Key    string
+	// Usage is what the tenant would store after the save
+	Usage Usage
+	Limit Limit
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("quota exceeded: saving %q would make tenant %q store %d bytes in %d objects, limited to %d bytes in %d objects",
+		e.Key, e.Tenant, e.Usage.Bytes, e.Usage.Objects, e.Limit.MaxBytes, e.Limit.MaxObjects)
+}
+
+type Options struct {
+	// Depth is the number of leading key segments naming the tenant, defaults
+	// to 1 so "workspace-1/plugins/a.pkg" belongs to "workspace-1"
+	Depth int
+	// Default is the limit of the tenants missing from Tenants
+	Default Limit
+	// Tenants overrides the limit of some tenants
+	Tenants map[string]Limit
+	// Store persists the usage, defaults to a MemoryUsageStore
+	Store UsageStore
+	// OnUsageError is called when the usage of a tenant could not be updated
+	// after a write, the usage is then scanned again the next time it's needed
+	OnUsageError func(tenant string, err error)
+}
+
+type accounting struct {
+	opts Options
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+	// stale are the tenants whose stored usage missed a write
+	stale map[string]bool
+}
+
+// setStale marks the stored usage of tenant as wrong or not
+func (a *accounting) setStale(tenant string, stale bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if stale {
+		a.stale[tenant] = true
+	} else {
+		delete(a.stale, tenant)
+	}
+}
+
+func (a *accounting) isStale(tenant string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stale[tenant]
+}
+
+// lock serializes the accounting of a tenant
+func (a *accounting) lock(tenant string) func() {
+	a.mu.Lock()
+	l, ok := a.locks[tenant]
+	if !ok {
+		l = &sync.Mutex{}
+		a.locks[tenant] = l
+	}
+	a.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// QuotaStorage caps the bytes and the objects stored by every tenant. The
+// usage of a tenant is seeded by scanning its prefix with List and State the
+// first time it's needed, and is then adjusted by every Save and Delete made
+// through the wrapper. A write whose usage can't be stored still succeeds, the
+// usage is scanned again instead. Keys with fewer segments than Depth are not
+// limited.
+type QuotaStorage struct {
+	inner      oss.OSS
+	accounting *accounting
+}
+
+func NewQuotaStorage(inner oss.OSS, opts Options) *QuotaStorage {
+	if opts.Depth <= 0 {
+		opts.Depth = 1
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryUsageStore()
+	}
+	return &QuotaStorage{
+		inner: inner,
+		accounting: &accounting{
+			opts:  opts,
+			locks: map[string]*sync.Mutex{},
+			stale: map[string]bool{},
+		},
+	}
+}
+
+// tenant returns the tenant of key, false is returned for the keys outside any
+// tenant. The keys with dot segments are rejected, they could be charged to a
+// tenant but written outside of it.
+func (q *QuotaStorage) tenant(key string) (string, bool, error) {
+	key = strings.Trim(key, "/")
+	if err := oss.ValidateKey(key); err != nil {
+		return "", false, err
+	}
+	segments := strings.Split(key, "/")
+	if len(segments) <= q.accounting.opts.Depth {
+		return "", false, nil
+	}
+	return strings.Join(segments[:q.accounting.opts.Depth], "/"), true, nil
+}
+
+func (q *QuotaStorage) limit(tenant string) Limit {
+	if limit, ok := q.accounting.opts.Tenants[tenant]; ok {
+		return limit
+	}
+	return q.accounting.opts.Default
+}
+
+// size returns the size of the stored object, false is returned if it's missing
+func (q *QuotaStorage) size(key string) (int64, bool, error) {
+	state, err := q.inner.State(key)
+	if err != nil {
+		if errclass.IsNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return state.Size, true, nil
+}
+
+// scan counts the objects of tenant in the storage
+func (q *QuotaStorage) scan(tenant string) (Usage, error) {
+	paths, err := q.inner.List(tenant)
+	if err != nil {
+		return Usage{}, err
+	}
+	usage := Usage{}
+	for _, path := range paths {
+		if path.IsDir {
+			continue
+		}
+		size, ok, err := q.size(tenant + "/" + path.Path)
+		if err != nil {
+			return Usage{}, err
+		}
+		if ok {
+			usage.Bytes += size
+			usage.Objects++
+		}
+	}
+	return usage, nil
+}
+
+// usage must be called with the tenant locked
+func (q *QuotaStorage) usage(tenant string) (Usage, error) {
+	if !q.accounting.isStale(tenant) {
+		usage, ok, err := q.accounting.opts.Store.Get(tenant)
+		if err != nil || ok {
+			return usage, err
+		}
+	}
+	return q.rescan(tenant)
+}
+
+// rescan must be called with the tenant locked
+func (q *QuotaStorage) rescan(tenant string) (Usage, error) {
+	usage, err := q.scan(tenant)
+	if err != nil {
+		return Usage{}, err
+	}
+	if err := q.accounting.opts.Store.Set(tenant, usage); err != nil {
+		return Usage{}, err
+	}
+	q.accounting.setStale(tenant, false)
+	return usage, nil
+}
+
+// written adjusts the usage of tenant after a write made to the storage, a
+// failure doesn't fail the write, the usage is scanned again instead
+func (q *QuotaStorage) written(tenant string, delta Usage) {
+	if err := q.adjust(tenant, delta); err != nil {
+		q.accounting.setStale(tenant, true)
+		if q.accounting.opts.OnUsageError != nil {
+			q.accounting.opts.OnUsageError(tenant, err)
+		}
+	}
+}
+
+// adjust adds delta to the usage of tenant, it must be called with the tenant locked
+func (q *QuotaStorage) adjust(tenant string, delta Usage) error {
+	usage, err := q.usage(tenant)
+	if err != nil {
+		return err
+	}
+	usage.Bytes = max(usage.Bytes+delta.Bytes, 0)
+	usage.Objects = max(usage.Objects+delta.Objects, 0)
+	return q.accounting.opts.Store.Set(tenant, usage)
+}
+
+// Usage returns the usage of tenant, it's scanned if it's not stored yet
+func (q *QuotaStorage) Usage(tenant string) (Usage, error) {
+	unlock := q.accounting.lock(tenant)
+	defer unlock()
+	return q.usage(tenant)
+}
+
+// Rescan counts the usage of tenant again, e.g. after the storage was
+// changed without the wrapper
+func (q *QuotaStorage) Rescan(tenant string) (Usage, error) {
+	unlock := q.accounting.lock(tenant)
+	defer unlock()
+	return q.rescan(tenant)
+}
+
+func (q *QuotaStorage) WithContext(ctx context.Context) oss.OSS {
+	return &QuotaStorage{
+		inner:      oss.WithContext(ctx, q.inner),
+		accounting: q.accounting,
+	}
+}
+
+func (q *QuotaStorage) Unwrap() oss.OSS {
+	return q.inner
+}
+
+// Save rejects the saves exceeding the limit of the tenant with an *Error,
+// overwriting an object only accounts for the difference of size
+func (q *QuotaStorage) Save(key string, data []byte) error {
+	tenant, ok, err := q.tenant(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return q.inner.Save(key, data)
+	}
+
+	unlock := q.accounting.lock(tenant)
+	defer unlock()
+
+	oldSize, exists, err := q.size(key)
+	if err != nil {
+		return err
+	}
+	delta := Usage{Bytes: int64(len(data)) - oldSize}
+	if !exists {
+		delta.Objects = 1
+	}
+
+	usage, err := q.usage(tenant)
+	if err != nil {
+		return err
+	}
+	usage.Bytes += delta.Bytes
+	usage.Objects += delta.Objects
+	// shrinking an object is always allowed
+	if limit := q.limit(tenant); (delta.Bytes > 0 || delta.Objects > 0) && !limit.allows(usage) {
+		return &Error{
+			Tenant: tenant,
+			Key:    key,
+			Usage:  usage,
+			Limit:  limit,
+		}
+	}
+
+	if err := q.inner.Save(key, data); err != nil {
+		return err
+	}
+	q.written(tenant, delta)
+	return nil
+}
+
+func (q *QuotaStorage) Delete(key string) error {
+	tenant, ok, err := q.tenant(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return q.inner.Delete(key)
+	}
+
+	unlock := q.accounting.lock(tenant)
+	defer unlock()
+
+	size, exists, err := q.size(key)
+	if err != nil {
+		return err
+	}
+	if err := q.inner.Delete(key); err != nil {
+		return err
+	}
+	if exists {
+		q.written(tenant, Usage{Bytes: -size, Objects: -1})
+	}
+	return nil
+}
+
+func (q *QuotaStorage) Load(key string) ([]byte, error) {
+	return q.inner.Load(key)
+}
+
+func (q *QuotaStorage) Exists(key string) (bool, error) {
+	return q.inner.Exists(key)
+}
+
+func (q *QuotaStorage) State(key string) (oss.OSSState, error) {
+	return q.inner.State(key)
+}
+
+func (q *QuotaStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return q.inner.List(prefix)
+}
+
+func (q *QuotaStorage) Type() string {
+	return q.inner.Type()
+}
@@ -0,0 +1,124 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaStorage(t *testing.T) {
+	inner := memory.New()
+	// objects stored before the wrapper are found by the scan
+	assert.Nil(t, inner.Save("workspace-1/existing", make([]byte, 10)))
+
+	storage := NewQuotaStorage(inner, Options{
+		Default: Limit{MaxBytes: 100, MaxObjects: 3},
+		Tenants: map[string]Limit{"workspace-2": {MaxObjects: 1}},
+	})
+
+	assert.Nil(t, storage.Save("workspace-1/a", make([]byte, 50)))
+	usage, err := storage.Usage("workspace-1")
+	assert.Nil(t, err)
+	assert.Equal(t, Usage{Bytes: 60, Objects: 2}, usage)
+
+	err = storage.Save("workspace-1/b", make([]byte, 41))
+	var quotaErr *Error
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "workspace-1", quotaErr.Tenant)
+	assert.Equal(t, Usage{Bytes: 101, Objects: 3}, quotaErr.Usage)
+	exists, _ := inner.Exists("workspace-1/b")
+	assert.False(t, exists)
+
+	// overwriting accounts for the difference only
+	assert.Nil(t, storage.Save("workspace-1/a", make([]byte, 90)))
+	usage, _ = storage.Usage("workspace-1")
+	assert.Equal(t, Usage{Bytes: 100, Objects: 2}, usage)
+
+	assert.Nil(t, storage.Delete("workspace-1/existing"))
+	assert.Nil(t, storage.Delete("workspace-1/missing"))
+	usage, _ = storage.Usage("workspace-1")
+	assert.Equal(t, Usage{Bytes: 90, Objects: 1}, usage)
+
+	// the tenants are limited separately
+	assert.Nil(t, storage.Save("workspace-2/a", make([]byte, 1000)))
+	assert.NotNil(t, storage.Save("workspace-2/b", []byte("b")))
+
+	// keys outside any tenant are not limited
+	assert.Nil(t, storage.Save("root", make([]byte, 1000)))
+
+	// a key with dot segments could be charged to a tenant but written to another
+	err = storage.Save("workspace-1/../workspace-3/x", []byte("x"))
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	err = storage.Delete("workspace-2/../workspace-1/a")
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+}
+
+// failingStore fails the Set calls while fail is set
+type failingStore struct {
+	*MemoryUsageStore
+	fail bool
+}
+
+func (f *failingStore) Set(tenant string, usage Usage) error {
+	if f.fail {
+		return errors.New("store unavailable")
+	}
+	return f.MemoryUsageStore.Set(tenant, usage)
+}
+
+func TestQuotaStorageUsageError(t *testing.T) {
+	inner := memory.New()
+	store := &failingStore{MemoryUsageStore: NewMemoryUsageStore()}
+	var failed []string
+	storage := NewQuotaStorage(inner, Options{
+		Store:        store,
+		OnUsageError: func(tenant string, err error) { failed = append(failed, tenant) },
+	})
+	assert.Nil(t, storage.Save("workspace-1/a", []byte("abc")))
+
+	// the write succeeded, so it's not reported as failed
+	store.fail = true
+	assert.Nil(t, storage.Save("workspace-1/b", []byte("bcd")))
+	assert.Equal(t, []string{"workspace-1"}, failed)
+	exists, _ := inner.Exists("workspace-1/b")
+	assert.True(t, exists)
+
+	// the usage missing the write is scanned again
+	store.fail = false
+	usage, err := storage.Usage("workspace-1")
+	assert.Nil(t, err)
+	assert.Equal(t, Usage{Bytes: 6, Objects: 2}, usage)
+	usage, _, _ = store.Get("workspace-1")
+	assert.Equal(t, Usage{Bytes: 6, Objects: 2}, usage)
+}
+
+func TestStorageUsageStore(t *testing.T) {
+	inner := memory.New()
+	store := NewStorageUsageStore(inner, ".quota")
+
+	_, ok, err := store.Get("workspace-1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	storage := NewQuotaStorage(inner, Options{Store: store})
+	assert.Nil(t, storage.Save("workspace-1/a", []byte("abc")))
+
+	usage, ok, err := store.Get("workspace-1")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Usage{Bytes: 3, Objects: 1}, usage)
+
+	// the usage is not scanned again by a new wrapper
+	assert.Nil(t, inner.Save("workspace-1/b", []byte("bcd")))
+	restarted := NewQuotaStorage(inner, Options{Store: store})
+	usage, err = restarted.Usage("workspace-1")
+	assert.Nil(t, err)
+	assert.Equal(t, Usage{Bytes: 3, Objects: 1}, usage)
+
+	usage, err = restarted.Rescan("workspace-1")
+	assert.Nil(t, err)
+	assert.Equal(t, Usage{Bytes: 6, Objects: 2}, usage)
+}
@@ -0,0 +1,81 @@
+package quota
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+// UsageStore persists the usage of the tenants
+type UsageStore interface {
+	// Get returns the usage of tenant, false is returned if it was never set
+	Get(tenant string) (Usage, bool, error)
+	Set(tenant string, usage Usage) error
+}
+
+// MemoryUsageStore keeps the usage in memory, it's scanned again after a restart
+type MemoryUsageStore struct {
+	mu    sync.Mutex
+	usage map[string]Usage
+}
+
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{usage: map[string]Usage{}}
+}
+
+func (m *MemoryUsageStore) Get(tenant string) (Usage, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage, ok := m.usage[tenant]
+	return usage, ok, nil
+}
+
+func (m *MemoryUsageStore) Set(tenant string, usage Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage[tenant] = usage
+	return nil
+}
+
+// StorageUsageStore persists the usage of every tenant as a JSON object
+// <prefix>/<tenant>.json, the prefix should be outside the tenants under quota
+type StorageUsageStore struct {
+	storage oss.OSS
+	prefix  string
+}
+
+func NewStorageUsageStore(storage oss.OSS, prefix string) *StorageUsageStore {
+	return &StorageUsageStore{
+		storage: storage,
+		prefix:  prefix,
+	}
+}
+
+func (s *StorageUsageStore) key(tenant string) string {
+	return s.prefix + "/" + tenant + ".json"
+}
+
+func (s *StorageUsageStore) Get(tenant string) (Usage, bool, error) {
+	data, err := s.storage.Load(s.key(tenant))
+	if err != nil {
+		if errclass.IsNotFound(err) {
+			return Usage{}, false, nil
+		}
+		return Usage{}, false, err
+	}
+	usage := Usage{}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return Usage{}, false, err
+	}
+	return usage, true, nil
+}
+
+func (s *StorageUsageStore) Set(tenant string, usage Usage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return s.storage.Save(s.key(tenant), data)
+}
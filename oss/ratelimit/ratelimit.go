@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+// Budget limits a class of operations, the zero value of a field means unlimited
+type Budget struct {
+	// RequestsPerSecond is the rate of operations
+	RequestsPerSecond float64
+	// RequestBurst is the number of operations allowed at once, defaults to RequestsPerSecond
+	RequestBurst int
+	// BytesPerSecond is the rate of transferred bytes. When it limits the reads,
+	// every Load sends a State request first so the bytes are paid before
+	// downloading, that request is charged as one more request
+	BytesPerSecond float64
+	// ByteBurst is the number of bytes allowed at once, defaults to BytesPerSecond
+	ByteBurst int
+	// MaxInFlight is the maximum number of concurrent operations
+	MaxInFlight int
+}
+
+type Options struct {
+	// Read limits Load, Exists, State and List
+	Read Budget
+	// Write limits Save and Delete
+	Write Budget
+}
+
+type limiter struct {
+	requests *rate.Limiter
+	bytes    *rate.Limiter
+	inFlight *semaphore.Weighted
+}
+
+func newLimiter(budget Budget) *limiter {
+	l := &limiter{}
+	if budget.RequestsPerSecond > 0 {
+		burst := budget.RequestBurst
+		if burst <= 0 {
+			burst = int(math.Ceil(budget.RequestsPerSecond))
+		}
+		l.requests = rate.NewLimiter(rate.Limit(budget.RequestsPerSecond), burst)
+	}
+	if budget.BytesPerSecond > 0 {
+		burst := budget.ByteBurst
+		if burst <= 0 {
+			burst = int(math.Ceil(budget.BytesPerSecond))
+		}
+		l.bytes = rate.NewLimiter(rate.Limit(budget.BytesPerSecond), burst)
+	}
+	if budget.MaxInFlight > 0 {
+		l.inFlight = semaphore.NewWeighted(int64(budget.MaxInFlight))
+	}
+	return l
+}
+
+// waitRequest waits for a request token
+func (l *limiter) waitRequest(ctx context.Context) error {
+	if l.requests == nil {
+		return nil
+	}
+	return l.requests.Wait(ctx)
+}
+
+// acquire waits for a request token and a free slot, release must be called
+// once the operation is done
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if err := l.waitRequest(ctx); err != nil {
+		return nil, err
+	}
+	if l.inFlight == nil {
+		return func() {}, nil
+	}
+	if err := l.inFlight.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { l.inFlight.Release(1) }, nil
+}
+
+// waitBytes waits until n bytes may be transferred, n may exceed the burst
+func (l *limiter) waitBytes(ctx context.Context, n int) error {
+	if l.bytes == nil {
+		return nil
+	}
+	burst := l.bytes.Burst()
+	for n > 0 {
+		chunk := min(n, burst)
+		if err := l.bytes.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// RateLimitStorage limits the rate, the bandwidth and the concurrency of the
+// operations of a storage, reads and writes have separate budgets. Waiting
+// stops when the context bound with WithContext is done.
+type RateLimitStorage struct {
+	inner oss.OSS
+	read  *limiter
+	write *limiter
+	ctx   context.Context
+}
+
+func NewRateLimitStorage(inner oss.OSS, opts Options) *RateLimitStorage {
+	return &RateLimitStorage{
+		inner: inner,
+		read:  newLimiter(opts.Read),
+		write: newLimiter(opts.Write),
+		ctx:   context.Background(),
+	}
+}
+
+// WithContext returns a copy of the storage which shares the budgets with the original one
+func (r *RateLimitStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *r
+	storage.inner = oss.WithContext(ctx, r.inner)
+	storage.ctx = ctx
+	return &storage
+}
+
+func (r *RateLimitStorage) Unwrap() oss.OSS {
+	return r.inner
+}
+
+func (r *RateLimitStorage) Save(key string, data []byte) error {
+	// the bytes are paid before uploading
+	if err := r.write.waitBytes(r.ctx, len(data)); err != nil {
+		return err
+	}
+	release, err := r.write.acquire(r.ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return r.inner.Save(key, data)
+}
+
+// Load pays the bytes before downloading when the read budget limits them.
+// The size is taken from a State request, which costs a request token and is
+// sent from the slot of the Load. An object which grew in between pays the
+// difference afterwards.
+func (r *RateLimitStorage) Load(key string) ([]byte, error) {
+	release, err := r.read.acquire(r.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	paid := 0
+	if r.read.bytes != nil {
+		if err := r.read.waitRequest(r.ctx); err != nil {
+			return nil, err
+		}
+		state, err := r.inner.State(key)
+		if err != nil {
+			return nil, err
+		}
+		paid = int(state.Size)
+		if err := r.read.waitBytes(r.ctx, paid); err != nil {
+			return nil, err
+		}
+	}
+	data, err := r.inner.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.read.waitBytes(r.ctx, len(data)-paid); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *RateLimitStorage) Exists(key string) (bool, error) {
+	release, err := r.read.acquire(r.ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return r.inner.Exists(key)
+}
+
+func (r *RateLimitStorage) State(key string) (oss.OSSState, error) {
+	release, err := r.read.acquire(r.ctx)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	defer release()
+	return r.inner.State(key)
+}
+
+func (r *RateLimitStorage) List(prefix string) ([]oss.OSSPath, error) {
+	release, err := r.read.acquire(r.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return r.inner.List(prefix)
+}
+
+func (r *RateLimitStorage) Delete(key string) error {
+	release, err := r.write.acquire(r.ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return r.inner.Delete(key)
+}
+
+func (r *RateLimitStorage) Type() string {
+	return r.inner.Type()
+}
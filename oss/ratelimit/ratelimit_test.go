@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStorage counts the loads reaching the storage
+type countingStorage struct {
+	oss.OSS
+	loads atomic.Int32
+}
+
+func (c *countingStorage) Load(key string) ([]byte, error) {
+	c.loads.Add(1)
+	return c.OSS.Load(key)
+}
+
+// slowStorage records the highest number of concurrent saves
+type slowStorage struct {
+	oss.OSS
+	current atomic.Int32
+	peak    atomic.Int32
+}
+
+func (s *slowStorage) Save(key string, data []byte) error {
+	n := s.current.Add(1)
+	defer s.current.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return s.OSS.Save(key, data)
+}
+
+func TestRateLimitMaxInFlight(t *testing.T) {
+	inner := &slowStorage{OSS: memory.New()}
+	storage := NewRateLimitStorage(inner, Options{Write: Budget{MaxInFlight: 2}})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, storage.Save("a/b", []byte("data")))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), inner.peak.Load())
+}
+
+func TestRateLimitRequests(t *testing.T) {
+	storage := NewRateLimitStorage(memory.New(), Options{
+		Read: Budget{RequestsPerSecond: 50, RequestBurst: 1},
+	})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, err := storage.Exists("a")
+		assert.Nil(t, err)
+	}
+	// the first request uses the burst, the next five wait 20ms each
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestRateLimitBytesAndContext(t *testing.T) {
+	storage := NewRateLimitStorage(memory.New(), Options{
+		Write: Budget{BytesPerSecond: 100, ByteBurst: 100},
+	})
+
+	// the burst covers the first save
+	assert.Nil(t, storage.Save("a", make([]byte, 100)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := storage.WithContext(ctx).Save("b", make([]byte, 1000))
+	assert.NotNil(t, err)
+
+	exists, _ := storage.Exists("b")
+	assert.False(t, exists)
+
+	// the write budget does not throttle reads
+	_, err = storage.WithContext(ctx).Load("a")
+	assert.False(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestRateLimitLoadPaysBeforeDownloading(t *testing.T) {
+	inner := &countingStorage{OSS: memory.New()}
+	assert.Nil(t, inner.Save("small", make([]byte, 50)))
+	assert.Nil(t, inner.Save("large", make([]byte, 1000)))
+	storage := NewRateLimitStorage(inner, Options{
+		Read: Budget{BytesPerSecond: 100, ByteBurst: 100},
+	})
+
+	data, err := storage.Load("small")
+	assert.Nil(t, err)
+	assert.Equal(t, 50, len(data))
+
+	// the large object is not downloaded when its bytes can't be paid in time
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = storage.WithContext(ctx).Load("large")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), inner.loads.Load())
+}
+
+func TestRateLimitLoadChargesTheStateRequest(t *testing.T) {
+	inner := memory.New()
+	assert.Nil(t, inner.Save("a", []byte("a")))
+	storage := NewRateLimitStorage(inner, Options{
+		Read: Budget{RequestsPerSecond: 1, RequestBurst: 2, BytesPerSecond: 100},
+	})
+
+	// the State and the Load use the whole burst
+	_, err := storage.Load("a")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = storage.WithContext(ctx).Exists("a")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,223 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 100 * time.Millisecond
+	defaultMaxDelay    = 5 * time.Second
+)
+
+type Options struct {
+	// MaxAttempts is the number of attempts of an operation including the first one
+	MaxAttempts int
+	// BaseDelay is the upper bound of the delay before the first retry, it doubles on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+	// Retryable decides whether an error is worth another attempt,
+	// the errors of the providers are classified by errclass by default
+	Retryable func(err error) bool
+	// OnRetry is called before waiting for the next attempt
+	OnRetry func(op oss.Operation, key string, attempt int, err error, delay time.Duration)
+}
+
+// Stats counts the attempts of an operation
+type Stats struct {
+	// Calls is the number of calls of the operation
+	Calls uint64
+	// Attempts is the number of requests sent to the storage
+	Attempts uint64
+	// Retries is the number of attempts after the first one
+	Retries uint64
+	// Exhausted is the number of calls which failed after retrying
+	Exhausted uint64
+}
+
+type counters struct {
+	calls     atomic.Uint64
+	attempts  atomic.Uint64
+	retries   atomic.Uint64
+	exhausted atomic.Uint64
+}
+
+// RetryStorage retries the failed operations of a storage with capped
+// exponential backoff and full jitter. All the operations of OSS are
+// idempotent, so every one of them is retried.
+type RetryStorage struct {
+	inner   oss.OSS
+	opts    Options
+	ctx     context.Context
+	stats   map[oss.Operation]*counters
+	randMu  *sync.Mutex
+	randSrc *rand.Rand
+}
+
+func NewRetryStorage(inner oss.OSS, opts Options) *RetryStorage {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = func(err error) bool {
+			return errclass.Classify(err).Retryable()
+		}
+	}
+
+	stats := make(map[oss.Operation]*counters, len(oss.Operations))
+	for _, op := range oss.Operations {
+		stats[op] = &counters{}
+	}
+
+	return &RetryStorage{
+		inner:   inner,
+		opts:    opts,
+		ctx:     context.Background(),
+		stats:   stats,
+		randMu:  &sync.Mutex{},
+		randSrc: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// WithContext returns a copy of the storage which stops retrying when ctx is done,
+// the copy shares the stats with the original one
+func (r *RetryStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *r
+	storage.ctx = ctx
+	storage.inner = oss.WithContext(ctx, r.inner)
+	return &storage
+}
+
+func (r *RetryStorage) Unwrap() oss.OSS {
+	return r.inner
+}
+
+// Stats returns the attempt counts of every operation
+func (r *RetryStorage) Stats() map[oss.Operation]Stats {
+	stats := make(map[oss.Operation]Stats, len(r.stats))
+	for op, c := range r.stats {
+		stats[op] = Stats{
+			Calls:     c.calls.Load(),
+			Attempts:  c.attempts.Load(),
+			Retries:   c.retries.Load(),
+			Exhausted: c.exhausted.Load(),
+		}
+	}
+	return stats
+}
+
+func (r *RetryStorage) Save(key string, data []byte) error {
+	_, err := do(r, oss.OperationSave, key, func() (struct{}, error) {
+		return struct{}{}, r.inner.Save(key, data)
+	})
+	return err
+}
+
+func (r *RetryStorage) Load(key string) ([]byte, error) {
+	return do(r, oss.OperationLoad, key, func() ([]byte, error) {
+		return r.inner.Load(key)
+	})
+}
+
+func (r *RetryStorage) Exists(key string) (bool, error) {
+	return do(r, oss.OperationExists, key, func() (bool, error) {
+		return r.inner.Exists(key)
+	})
+}
+
+func (r *RetryStorage) State(key string) (oss.OSSState, error) {
+	return do(r, oss.OperationState, key, func() (oss.OSSState, error) {
+		return r.inner.State(key)
+	})
+}
+
+func (r *RetryStorage) List(prefix string) ([]oss.OSSPath, error) {
+	return do(r, oss.OperationList, prefix, func() ([]oss.OSSPath, error) {
+		return r.inner.List(prefix)
+	})
+}
+
+func (r *RetryStorage) Delete(key string) error {
+	_, err := do(r, oss.OperationDelete, key, func() (struct{}, error) {
+		return struct{}{}, r.inner.Delete(key)
+	})
+	return err
+}
+
+func (r *RetryStorage) Type() string {
+	return r.inner.Type()
+}
+
+func do[T any](r *RetryStorage, op oss.Operation, key string, fn func() (T, error)) (T, error) {
+	c := r.stats[op]
+	c.calls.Add(1)
+
+	var result T
+	var err error
+	for attempt := 1; ; attempt++ {
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			if err == nil {
+				err = ctxErr
+			}
+			return result, err
+		}
+
+		c.attempts.Add(1)
+		if attempt > 1 {
+			c.retries.Add(1)
+		}
+		result, err = fn()
+		if err == nil || !r.opts.Retryable(err) {
+			return result, err
+		}
+		if attempt >= r.opts.MaxAttempts {
+			c.exhausted.Add(1)
+			return result, err
+		}
+
+		delay := r.backoff(attempt)
+		// there is no point in waiting for an attempt which can't finish in time
+		if deadline, ok := r.ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return result, err
+		}
+		if r.opts.OnRetry != nil {
+			r.opts.OnRetry(op, key, attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random delay between zero and the capped exponential delay of the attempt
+func (r *RetryStorage) backoff(attempt int) time.Duration {
+	delay := r.opts.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if exp := r.opts.BaseDelay << shift; exp > 0 && exp < delay {
+			delay = exp
+		}
+	}
+
+	r.randMu.Lock()
+	defer r.randMu.Unlock()
+	return time.Duration(r.randSrc.Int63n(int64(delay) + 1))
+}
@@ -0,0 +1,107 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string       { return "status error" }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+// flakyStorage fails the first loads with the given error
+type flakyStorage struct {
+	oss.OSS
+	failures int
+	err      error
+}
+
+func (f *flakyStorage) Load(key string) ([]byte, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, f.err
+	}
+	return f.OSS.Load(key)
+}
+
+func newFlakyStorage(t *testing.T, failures int, err error) *flakyStorage {
+	storage, err2 := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err2)
+	assert.Nil(t, storage.Save("a/b", []byte("data")))
+	return &flakyStorage{OSS: storage, failures: failures, err: err}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	inner := newFlakyStorage(t, 2, statusError(503))
+	retries := 0
+	storage := NewRetryStorage(inner, Options{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		OnRetry: func(op oss.Operation, key string, attempt int, err error, delay time.Duration) {
+			retries++
+			assert.Equal(t, oss.OperationLoad, op)
+			assert.LessOrEqual(t, delay, time.Millisecond<<(attempt-1))
+		},
+	})
+
+	data, err := storage.Load("a/b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+	assert.Equal(t, 2, retries)
+
+	stats := storage.Stats()[oss.OperationLoad]
+	assert.Equal(t, Stats{Calls: 1, Attempts: 3, Retries: 2}, stats)
+}
+
+func TestRetryExhausted(t *testing.T) {
+	inner := newFlakyStorage(t, 5, statusError(429))
+	storage := NewRetryStorage(inner, Options{MaxAttempts: 2, BaseDelay: time.Millisecond})
+
+	_, err := storage.Load("a/b")
+	assert.Equal(t, statusError(429), err)
+	assert.Equal(t, Stats{Calls: 1, Attempts: 2, Retries: 1, Exhausted: 1}, storage.Stats()[oss.OperationLoad])
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	inner := newFlakyStorage(t, 1, &fs.PathError{Op: "open", Path: "a/b", Err: fs.ErrNotExist})
+	storage := NewRetryStorage(inner, Options{BaseDelay: time.Millisecond})
+
+	_, err := storage.Load("a/b")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.Equal(t, uint64(1), storage.Stats()[oss.OperationLoad].Attempts)
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	inner := newFlakyStorage(t, 5, statusError(503))
+	storage := NewRetryStorage(inner, Options{
+		MaxAttempts: 5,
+		BaseDelay:   time.Hour,
+		MaxDelay:    time.Hour,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := storage.WithContext(ctx).Load("a/b")
+	assert.Equal(t, statusError(503), err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryBackoffIsCapped(t *testing.T) {
+	storage := NewRetryStorage(newFlakyStorage(t, 0, nil), Options{
+		BaseDelay: 10 * time.Millisecond,
+		MaxDelay:  40 * time.Millisecond,
+	})
+	for attempt := 1; attempt < 100; attempt++ {
+		assert.LessOrEqual(t, storage.backoff(attempt), 40*time.Millisecond)
+	}
+}
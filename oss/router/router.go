@@ -0,0 +1,237 @@
+package router
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+)
+
+// Type is returned by Type of the router
+const Type = "router"
+
+type mount struct {
+	prefix  string
+	storage oss.OSS
+}
+
+// RouterStorage routes the keys to the storages mounted on their longest
+// matching prefix, like a mount table. The mounted storages see the keys
+// relative to their mount point, the mount on "" receives the keys matching
+// no other mount.
+type RouterStorage struct {
+	// mounts are ordered from the longest to the shortest prefix
+	mounts []mount
+}
+
+// NewRouterStorage mounts every storage of mounts on its prefix
+func NewRouterStorage(mounts map[string]oss.OSS) (*RouterStorage, error) {
+	r := &RouterStorage{}
+	seen := map[string]bool{}
+	for prefix, storage := range mounts {
+		normalized := strings.Trim(prefix, "/")
+		if storage == nil {
+			return nil, oss.ErrArgumentInvalid.Errorf("storage of mount %q cannot be nil", prefix)
+		}
+		if seen[normalized] {
+			return nil, oss.ErrArgumentInvalid.Errorf("mount %q is duplicated", prefix)
+		}
+		for _, segment := range strings.Split(normalized, "/") {
+			if segment == "." || segment == ".." || (segment == "" && normalized != "") {
+				return nil, oss.ErrArgumentInvalid.Errorf("mount %q is not a valid prefix", prefix)
+			}
+		}
+		seen[normalized] = true
+		r.mounts = append(r.mounts, mount{prefix: normalized, storage: storage})
+	}
+	sort.Slice(r.mounts, func(i, j int) bool {
+		return len(r.mounts[i].prefix) > len(r.mounts[j].prefix)
+	})
+	return r, nil
+}
+
+// under reports whether key is prefix or a key below it
+func under(key string, prefix string) bool {
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+"/")
+}
+
+func relative(key string, prefix string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+}
+
+// match returns the mount of key, the mount point itself belongs to the mount
+func (r *RouterStorage) match(key string) (*mount, bool) {
+	for i := range r.mounts {
+		if under(key, r.mounts[i].prefix) {
+			return &r.mounts[i], true
+		}
+	}
+	return nil, false
+}
+
+// resolve returns the mount of an object key and the key in the mounted storage,
+// the keys with dot segments are rejected since they could escape their mount
+func (r *RouterStorage) resolve(key string) (*mount, string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if err := oss.ValidateKey(key); err != nil {
+		return nil, "", err
+	}
+	m, ok := r.match(key)
+	if !ok {
+		return nil, "", oss.ErrArgumentInvalid.Errorf("no storage is mounted for %q", key)
+	}
+	rel := relative(key, m.prefix)
+	if rel == "" {
+		return nil, "", oss.ErrArgumentInvalid.Errorf("%q is a mount point, not an object", key)
+	}
+	return m, rel, nil
+}
+
+// route returns the storage of an object key and the key in the storage
+func (r *RouterStorage) route(key string) (oss.OSS, string, error) {
+	m, rel, err := r.resolve(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return m.storage, rel, nil
+}
+
+func (r *RouterStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := &RouterStorage{mounts: make([]mount, len(r.mounts))}
+	for i, m := range r.mounts {
+		storage.mounts[i] = mount{prefix: m.prefix, storage: oss.WithContext(ctx, m.storage)}
+	}
+	return storage
+}
+
+func (r *RouterStorage) Save(key string, data []byte) error {
+	storage, key, err := r.route(key)
+	if err != nil {
+		return err
+	}
+	return storage.Save(key, data)
+}
+
+func (r *RouterStorage) Load(key string) ([]byte, error) {
+	storage, key, err := r.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Load(key)
+}
+
+func (r *RouterStorage) Exists(key string) (bool, error) {
+	storage, key, err := r.route(key)
+	if err != nil {
+		return false, err
+	}
+	return storage.Exists(key)
+}
+
+func (r *RouterStorage) State(key string) (oss.OSSState, error) {
+	storage, key, err := r.route(key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	return storage.State(key)
+}
+
+func (r *RouterStorage) Delete(key string) error {
+	storage, key, err := r.route(key)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(key)
+}
+
+// Copy copies within a mount through the mounted storage, which may copy on
+// the server side. Across mounts the whole object is loaded from the source
+// and saved to the destination, so it's held in memory for the duration of
+// the copy, like oss.Copy does for the storages which are not Copier.
+func (r *RouterStorage) Copy(src string, dst string) error {
+	srcMount, srcKey, err := r.resolve(src)
+	if err != nil {
+		return err
+	}
+	dstMount, dstKey, err := r.resolve(dst)
+	if err != nil {
+		return err
+	}
+	if srcMount == dstMount {
+		return oss.Copy(srcMount.storage, srcKey, dstKey)
+	}
+	data, err := srcMount.storage.Load(srcKey)
+	if err != nil {
+		return err
+	}
+	return dstMount.storage.Save(dstKey, data)
+}
+
+// List merges the paths of the mount of prefix with the ones of the mounts
+// below prefix, the mount points are listed as directories. The paths of a
+// storage hidden by a nested mount are skipped.
+func (r *RouterStorage) List(prefix string) ([]oss.OSSPath, error) {
+	prefix = strings.Trim(prefix, "/")
+	if err := oss.ValidateKey(prefix); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var paths []oss.OSSPath
+	add := func(path oss.OSSPath) {
+		if !seen[path.Path] {
+			seen[path.Path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for i := range r.mounts {
+		m := &r.mounts[i]
+		var mounted []oss.OSSPath
+		var err error
+		switch {
+		case under(prefix, m.prefix):
+			// the mount of prefix, nested mounts are handled by their own iteration
+			owner, _ := r.match(prefix)
+			if owner != m {
+				continue
+			}
+			mounted, err = m.storage.List(relative(prefix, m.prefix))
+		case under(m.prefix, prefix):
+			// a mount below prefix, its mount point and the directories
+			// leading to it are listed
+			point := relative(m.prefix, prefix)
+			segments := strings.Split(point, "/")
+			for j := range segments {
+				add(oss.OSSPath{Path: strings.Join(segments[:j+1], "/"), IsDir: true})
+			}
+			mounted, err = m.storage.List("")
+			for j := range mounted {
+				mounted[j].Path = point + "/" + mounted[j].Path
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range mounted {
+			full := strings.TrimPrefix(prefix+"/"+path.Path, "/")
+			if owner, _ := r.match(full); owner != m {
+				continue
+			}
+			add(path)
+		}
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Path < paths[j].Path
+	})
+	return paths, nil
+}
+
+func (r *RouterStorage) Type() string {
+	return Type
+}
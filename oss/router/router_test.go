@@ -0,0 +1,119 @@
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterStorage(t *testing.T) {
+	root := memory.New()
+	plugins := memory.New()
+	uploads := memory.New()
+	storage, err := NewRouterStorage(map[string]oss.OSS{
+		"":                    root,
+		"plugins/":            plugins,
+		"workspaces/uploads/": uploads,
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, storage.Save("plugins/a.pkg", []byte("a")))
+	assert.Nil(t, storage.Save("workspaces/uploads/b.txt", []byte("b")))
+	assert.Nil(t, storage.Save("tmp/c", []byte("c")))
+
+	data, err := plugins.Load("a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+	exists, _ := uploads.Exists("b.txt")
+	assert.True(t, exists)
+	exists, _ = root.Exists("tmp/c")
+	assert.True(t, exists)
+
+	// a key of the root storage hidden by a mount is not listed
+	assert.Nil(t, root.Save("plugins/hidden", []byte("x")))
+
+	paths, err := storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{
+		{Path: "plugins", IsDir: true},
+		{Path: "plugins/a.pkg"},
+		{Path: "tmp/c"},
+		{Path: "workspaces", IsDir: true},
+		{Path: "workspaces/uploads", IsDir: true},
+		{Path: "workspaces/uploads/b.txt"},
+	}, paths)
+
+	paths, err = storage.List("workspaces")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "uploads", IsDir: true}, {Path: "uploads/b.txt"}}, paths)
+
+	paths, err = storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}}, paths)
+
+	_, err = storage.Load("plugins")
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+
+	// dot segments could escape the mount, e.g. on the local storage
+	assert.Nil(t, root.Save("secrets/x", []byte("s")))
+	_, err = storage.Load("plugins/../secrets/x")
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	err = storage.Save("plugins/./../secrets/x", []byte("x"))
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	_, err = storage.List("plugins/..")
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	assert.Equal(t, Type, storage.Type())
+}
+
+func TestRouterCopy(t *testing.T) {
+	plugins := memory.New()
+	uploads := memory.New()
+	storage, err := NewRouterStorage(map[string]oss.OSS{
+		"plugins": plugins,
+		"uploads": uploads,
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, storage.Save("uploads/a.pkg", []byte("a")))
+	assert.Nil(t, oss.Copy(storage, "uploads/a.pkg", "plugins/a.pkg"))
+	assert.Nil(t, storage.Copy("plugins/a.pkg", "plugins/b.pkg"))
+
+	data, err := plugins.Load("b.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+
+	// nothing is mounted on the root
+	err = storage.Save("other", []byte("x"))
+	assert.True(t, errors.Is(err, oss.ErrArgumentInvalid))
+	assert.Contains(t, err.Error(), `"other"`)
+	_, err = storage.Load("plugins")
+	assert.NotContains(t, err.Error(), `"other"`)
+
+	_, err = NewRouterStorage(map[string]oss.OSS{"a": plugins, "/a/": uploads})
+	assert.NotNil(t, err)
+}
+
+// taggedStorage is not comparable, comparing two of them as oss.OSS panics
+type taggedStorage struct {
+	oss.OSS
+	tags map[string]string
+}
+
+func TestRouterCopyAcrossMounts(t *testing.T) {
+	shared := memory.New()
+	storage, err := NewRouterStorage(map[string]oss.OSS{
+		"a": taggedStorage{OSS: shared},
+		"b": taggedStorage{OSS: shared},
+	})
+	assert.Nil(t, err)
+
+	// the mounts are compared, not the storages
+	assert.Nil(t, storage.Save("a/x", []byte("x")))
+	assert.Nil(t, storage.Copy("a/x", "b/y"))
+	data, err := shared.Load("y")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("x"), data)
+}
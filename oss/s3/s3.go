@@ -12,16 +12,27 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
 	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 )
 
 type S3Storage struct {
-	bucket string
-	client *s3.Client
+	bucket      string
+	region      string
+	client      *s3.Client
+	ctx         context.Context
+	storageType string
 }
 
 func NewS3Storage(args oss.OSSArgs) (oss.OSS, error) {
+	return NewS3CompatibleStorage(args, oss.OSS_TYPE_S3)
+}
+
+// NewS3CompatibleStorage creates the storage of a provider speaking the S3
+// API, storageType is returned by its Type
+func NewS3CompatibleStorage(args oss.OSSArgs, storageType string) (oss.OSS, error) {
 	var err error
 	if args.S3 == nil {
 		return nil, oss.ErrArgumentInvalid.WithDetail("can't find s3 argument in OSSArgs")
@@ -40,14 +51,24 @@ func NewS3Storage(args oss.OSSArgs) (oss.OSS, error) {
 	useIamRole := args.S3.UseIamRole
 	signatureVersion := args.S3.SignatureVersion
 
+	httpClient, err := args.S3.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+
 	var cfg aws.Config
 	var client *s3.Client
 
 	if useAws {
+		var loadOptions []func(*config.LoadOptions) error
+		if httpClient != nil {
+			loadOptions = append(loadOptions, config.WithHTTPClient(httpClient))
+		}
+
 		if (ak == "" && sk == "") || useIamRole {
 			cfg, err = config.LoadDefaultConfig(
 				context.TODO(),
-				config.WithRegion(region),
+				append(loadOptions, config.WithRegion(region))...,
 			)
 		} else {
 			// 处理签名版本和凭证
@@ -64,8 +85,10 @@ func NewS3Storage(args oss.OSSArgs) (oss.OSS, error) {
 
 			cfg, err = config.LoadDefaultConfig(
 				context.TODO(),
-				config.WithRegion(region),
-				config.WithCredentialsProvider(credProvider),
+				append(loadOptions,
+					config.WithRegion(region),
+					config.WithCredentialsProvider(credProvider),
+				)...,
 			)
 		}
 		if err != nil {
@@ -77,6 +100,10 @@ func NewS3Storage(args oss.OSSArgs) (oss.OSS, error) {
 				options.BaseEndpoint = aws.String(endpoint)
 			}
 			options.UsePathStyle = usePathStyle
+			if args.S3.ChecksumWhenRequired {
+				options.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+				options.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+			}
 		})
 	} else {
 		var credProvider aws.CredentialsProvider
@@ -85,7 +112,7 @@ func NewS3Storage(args oss.OSSArgs) (oss.OSS, error) {
 		} else {
 			credProvider = credentials.NewStaticCredentialsProvider(ak, sk, "")
 		}
-		client = s3.New(s3.Options{
+		options := s3.Options{
 			Credentials:  credProvider,
 			UsePathStyle: usePathStyle,
 			Region:       region,
@@ -102,25 +129,23 @@ func NewS3Storage(args oss.OSSArgs) (oss.OSS, error) {
 						Source:            aws.EndpointSourceCustom,
 					}, nil
 				}),
-		})
+		}
+		if httpClient != nil {
+			options.HTTPClient = httpClient
+		}
+		if args.S3.ChecksumWhenRequired {
+			options.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			options.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		client = s3.New(options)
 	}
 
-	// check bucket
-	_, err = client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
-		Bucket: aws.String(bucket),
-	})
+	storage := &S3Storage{bucket: bucket, region: region, client: client, ctx: context.Background(), storageType: storageType}
+	err = storage.EnsureBucket(args.S3.Provisioning)
 	if err != nil {
-		var apiErr smithy.APIError
-		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
-			_, err = client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-				Bucket: aws.String(bucket),
-			})
-			if err != nil {
-				return nil, oss.ErrProviderInit.WithError(err)
-			}
-		}
+		return nil, err
 	}
-	return &S3Storage{bucket: bucket, client: client}, nil
+	return prefix.Wrap(storage, args.S3.Prefix)
 }
 
 func normalizeSignatureVersion(version string) string {
@@ -134,8 +159,70 @@ func normalizeSignatureVersion(version string) string {
 	}
 }
 
+// EnsureBucket applies the provisioning to the bucket, a bucket can only be
+// created in the region of the client, so a different Region is rejected
+func (s *S3Storage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	if err := provisioning.CheckRegion(s.region); err != nil {
+		return err
+	}
+	return provisioning.Ensure(s.bucket, s.bucketExists, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *S3Storage) bucketExists() (bool, error) {
+	_, err := s.client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3Storage) createBucket(provisioning oss.BucketProvisioning) error {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(s.bucket),
+	}
+	region := s.region
+	// us-east-1 is the default location and must not be sent as a constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+	if provisioning.ACL != "" {
+		input.ACL = types.BucketCannedACL(provisioning.ACL)
+	}
+	_, err := s.client.CreateBucket(context.TODO(), input)
+	if err != nil {
+		return err
+	}
+
+	if provisioning.Versioning {
+		_, err = s.client.PutBucketVersioning(context.TODO(), &s3.PutBucketVersioningInput{
+			Bucket: aws.String(s.bucket),
+			VersioningConfiguration: &types.VersioningConfiguration{
+				Status: types.BucketVersioningStatusEnabled,
+			},
+		})
+	}
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *S3Storage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
 func (s *S3Storage) Save(key string, data []byte) error {
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+	_, err := s.client.PutObject(s.ctx, &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 		Body:   bytes.NewReader(data),
@@ -144,7 +231,7 @@ func (s *S3Storage) Save(key string, data []byte) error {
 }
 
 func (s *S3Storage) Load(key string) ([]byte, error) {
-	resp, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+	resp, err := s.client.GetObject(s.ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -156,7 +243,7 @@ func (s *S3Storage) Load(key string) ([]byte, error) {
 }
 
 func (s *S3Storage) Exists(key string) (bool, error) {
-	_, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+	_, err := s.client.HeadObject(s.ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -164,7 +251,7 @@ func (s *S3Storage) Exists(key string) (bool, error) {
 }
 
 func (s *S3Storage) Delete(key string) error {
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+	_, err := s.client.DeleteObject(s.ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -172,8 +259,8 @@ func (s *S3Storage) Delete(key string) error {
 }
 
 func (s *S3Storage) List(prefix string) ([]oss.OSSPath, error) {
-	// append a slash to the prefix if it doesn't end with one
-	if !strings.HasSuffix(prefix, "/") {
+	// append a slash to the prefix if it doesn't end with one, an empty prefix lists the bucket
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 
@@ -185,7 +272,7 @@ func (s *S3Storage) List(prefix string) ([]oss.OSSPath, error) {
 
 	paginator := s3.NewListObjectsV2Paginator(s.client, input)
 	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+		page, err := paginator.NextPage(s.ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -205,7 +292,7 @@ func (s *S3Storage) List(prefix string) ([]oss.OSSPath, error) {
 }
 
 func (s *S3Storage) State(key string) (oss.OSSState, error) {
-	resp, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+	resp, err := s.client.HeadObject(s.ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -223,11 +310,12 @@ func (s *S3Storage) State(key string) (oss.OSSState, error) {
 	return oss.OSSState{
 		Size:         *resp.ContentLength,
 		LastModified: *resp.LastModified,
+		ETag:         aws.ToString(resp.ETag),
 	}, nil
 }
 
 func (s *S3Storage) Type() string {
-	return oss.OSS_TYPE_S3
+	return s.storageType
 }
 
 func ToPtr[T any](value T) *T {
@@ -0,0 +1,350 @@
+package supabase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
+)
+
+const (
+	// emptyFolderPlaceholder is the object Supabase creates for the empty folders
+	emptyFolderPlaceholder = ".emptyFolderPlaceholder"
+	// defaultListLimit is the page size of the listings
+	defaultListLimit = 1000
+)
+
+// Error is returned for the failed requests, Supabase reports some errors
+// like a missing object with the status 400 and the real status in the body,
+// StatusCode is the one of the body when it has one
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("supabase: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *Error) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+func isNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// SupabaseStorage talks to the REST API of Supabase Storage with the
+// service key, which bypasses the row level security of the bucket
+type SupabaseStorage struct {
+	endpoint string
+	key      string
+	bucket   string
+	client   *http.Client
+	ctx      context.Context
+	// listLimit is the page size of the listings, a shorter page is the last one
+	listLimit int
+}
+
+func NewSupabaseStorage(args oss.OSSArgs) (oss.OSS, error) {
+	if args.Supabase == nil {
+		return nil, oss.ErrArgumentInvalid.WithDetail("can't find Supabase argument in OSSArgs")
+	}
+
+	err := args.Supabase.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := args.Supabase.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	storage := &SupabaseStorage{
+		endpoint:  strings.TrimSuffix(args.Supabase.URL, "/") + "/storage/v1",
+		key:       args.Supabase.ServiceKey,
+		bucket:    args.Supabase.Bucket,
+		client:    client,
+		ctx:       context.Background(),
+		listLimit: defaultListLimit,
+	}
+	err = storage.EnsureBucket(args.Supabase.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.Supabase.Prefix)
+}
+
+// objectPath escapes every segment of key
+func (s *SupabaseStorage) objectPath(route string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return route + "/" + url.PathEscape(s.bucket) + "/" + strings.Join(segments, "/")
+}
+
+// do sends a request and turns the responses which are not 2xx into *Error
+func (s *SupabaseStorage) do(ctx context.Context, method string, path string, body []byte, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	req.Header.Set("apikey", s.key)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, parseError(resp)
+}
+
+func parseError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+	raw, _ := io.ReadAll(resp.Body)
+	body := struct {
+		StatusCode json.RawMessage `json:"statusCode"`
+		Error      string          `json:"error"`
+		Message    string          `json:"message"`
+	}{}
+	if json.Unmarshal(raw, &body) != nil {
+		return e
+	}
+	// the status is a string or a number
+	if status, err := strconv.Atoi(strings.Trim(string(body.StatusCode), `"`)); err == nil && status > 0 {
+		e.StatusCode = status
+	}
+	e.Code = body.Error
+	if body.Message != "" {
+		e.Message = body.Message
+	}
+	return e
+}
+
+func (s *SupabaseStorage) doJSON(ctx context.Context, method string, path string, in any, out any) error {
+	var body []byte
+	header := http.Header{}
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.do(ctx, method, path, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// EnsureBucket applies the provisioning to the bucket, ACL is private or
+// public-read and versioning is not supported by Supabase
+func (s *SupabaseStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(s.bucket, s.bucketExists, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *SupabaseStorage) bucketExists() (bool, error) {
+	err := s.doJSON(context.Background(), http.MethodGet, "/bucket/"+url.PathEscape(s.bucket), nil, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SupabaseStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	if provisioning.Versioning {
+		return oss.ErrArgumentInvalid.Errorf("supabase does not support bucket versioning")
+	}
+	public := false
+	switch provisioning.ACL {
+	case "", "private":
+	case "public-read":
+		public = true
+	default:
+		return oss.ErrArgumentInvalid.Errorf("unknown acl %q, supabase supports private and public-read", provisioning.ACL)
+	}
+	return s.doJSON(context.Background(), http.MethodPost, "/bucket", map[string]any{
+		"id":     s.bucket,
+		"name":   s.bucket,
+		"public": public,
+	}, nil)
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *SupabaseStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
+// Save creates the object or replaces it
+func (s *SupabaseStorage) Save(key string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("x-upsert", "true")
+	resp, err := s.do(s.ctx, http.MethodPost, s.objectPath("/object", key), data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+func (s *SupabaseStorage) Load(key string) ([]byte, error) {
+	resp, err := s.do(s.ctx, http.MethodGet, s.objectPath("/object", key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Exists asks the object info when HEAD fails with a 400, since a HEAD error
+// has no body telling the real status
+func (s *SupabaseStorage) Exists(key string) (bool, error) {
+	resp, err := s.do(s.ctx, http.MethodHead, s.objectPath("/object", key), nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		return true, nil
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest {
+		return false, err
+	}
+
+	err = s.doJSON(s.ctx, http.MethodGet, s.objectPath("/object/info", key), nil, &objectInfo{})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type objectInfo struct {
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified"`
+	ETag         string `json:"etag"`
+}
+
+func (s *SupabaseStorage) State(key string) (oss.OSSState, error) {
+	info := objectInfo{}
+	err := s.doJSON(s.ctx, http.MethodGet, s.objectPath("/object/info", key), nil, &info)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	lastModified, _ := time.Parse(time.RFC3339Nano, info.LastModified)
+	return oss.OSSState{
+		Size:         info.Size,
+		LastModified: lastModified,
+		ETag:         info.ETag,
+	}, nil
+}
+
+type listEntry struct {
+	Name string  `json:"name"`
+	ID   *string `json:"id"`
+}
+
+// List walks the folders below prefix, Supabase only lists one level at a time
+func (s *SupabaseStorage) List(prefix string) ([]oss.OSSPath, error) {
+	keys := make([]oss.OSSPath, 0)
+	err := s.walk(strings.Trim(prefix, "/"), "", &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *SupabaseStorage) walk(folder string, relative string, keys *[]oss.OSSPath) error {
+	for offset := 0; ; {
+		var entries []listEntry
+		err := s.doJSON(s.ctx, http.MethodPost, "/object/list/"+url.PathEscape(s.bucket), map[string]any{
+			"prefix": folder,
+			"limit":  s.listLimit,
+			"offset": offset,
+			"sortBy": map[string]string{"column": "name", "order": "asc"},
+		}, &entries)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := relative + entry.Name
+			// folders have no id
+			if entry.ID == nil {
+				child := entry.Name
+				if folder != "" {
+					child = folder + "/" + entry.Name
+				}
+				if err := s.walk(child, path+"/", keys); err != nil {
+					return err
+				}
+				continue
+			}
+			if entry.Name == emptyFolderPlaceholder {
+				continue
+			}
+			*keys = append(*keys, oss.OSSPath{Path: path, IsDir: false})
+		}
+		if len(entries) < s.listLimit {
+			return nil
+		}
+		offset += len(entries)
+	}
+}
+
+// Delete succeeds if the object does not exist
+func (s *SupabaseStorage) Delete(key string) error {
+	return s.doJSON(s.ctx, http.MethodDelete, "/object/"+url.PathEscape(s.bucket), map[string]any{
+		"prefixes": []string{key},
+	}, nil)
+}
+
+func (s *SupabaseStorage) Type() string {
+	return oss.OSS_TYPE_SUPABASE
+}
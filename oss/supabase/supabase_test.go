@@ -0,0 +1,249 @@
+package supabase
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/stretchr/testify/assert"
+)
+
+var modified = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fakeSupabase serves the storage API for a single bucket, it reports the
+// missing objects like Supabase with a 400. The keys below forbidden fail
+// with a 400 too and a 403 in the body.
+type fakeSupabase struct {
+	mu        sync.Mutex
+	exists    bool
+	public    bool
+	objects   map[string][]byte
+	forbidden string
+}
+
+func (f *fakeSupabase) fail(w http.ResponseWriter, status string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"statusCode": status, "error": message, "message": message})
+}
+
+func (f *fakeSupabase) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer service-key" || r.Header.Get("apikey") != "service-key" {
+		f.fail(w, "403", "Unauthorized")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/storage/v1")
+
+	switch {
+	case path == "/bucket" && r.Method == http.MethodPost:
+		body := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.exists, f.public = true, body["public"] == true
+		return
+	case path == "/bucket/dify":
+		if !f.exists {
+			f.fail(w, "404", "Bucket not found")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": "dify", "name": "dify"})
+		return
+	case path == "/object/list/dify":
+		f.list(w, r)
+		return
+	case path == "/object/dify" && r.Method == http.MethodDelete:
+		body := struct{ Prefixes []string }{}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, key := range body.Prefixes {
+			delete(f.objects, key)
+		}
+		json.NewEncoder(w).Encode([]any{})
+		return
+	}
+
+	if key, ok := strings.CutPrefix(path, "/object/info/dify/"); ok {
+		if f.forbidden != "" && strings.HasPrefix(key, f.forbidden) {
+			f.fail(w, "403", "Unauthorized")
+			return
+		}
+		data, ok := f.objects[key]
+		if !ok {
+			f.fail(w, "404", "Object not found")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":          key,
+			"size":          len(data),
+			"etag":          "etag-" + key,
+			"last_modified": modified.Format(time.RFC3339Nano),
+		})
+		return
+	}
+
+	key := strings.TrimPrefix(path, "/object/dify/")
+	data, ok := f.objects[key]
+	switch r.Method {
+	case http.MethodPost:
+		if ok && r.Header.Get("x-upsert") != "true" {
+			f.fail(w, "409", "Duplicate")
+			return
+		}
+		f.objects[key], _ = io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]string{"Key": "dify/" + key})
+	case http.MethodHead:
+		if !ok || (f.forbidden != "" && strings.HasPrefix(key, f.forbidden)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case http.MethodGet:
+		if !ok {
+			f.fail(w, "404", "Object not found")
+			return
+		}
+		w.Write(data)
+	}
+}
+
+// list returns the objects and the folders directly below the prefix
+func (f *fakeSupabase) list(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Prefix string
+		Limit  int
+		Offset int
+	}{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	folder := body.Prefix
+	if folder != "" {
+		folder += "/"
+	}
+	entries := map[string]bool{}
+	for key := range f.objects {
+		rest, ok := strings.CutPrefix(key, folder)
+		if !ok {
+			continue
+		}
+		name, _, isFolder := strings.Cut(rest, "/")
+		entries[name] = entries[name] || !isFolder
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	page := []map[string]any{}
+	for i := body.Offset; i < len(names) && i < body.Offset+body.Limit; i++ {
+		entry := map[string]any{"name": names[i], "id": nil}
+		if entries[names[i]] {
+			entry["id"] = "id-" + names[i]
+		}
+		page = append(page, entry)
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func newStorage(t *testing.T, fake *fakeSupabase, provisioning oss.BucketProvisioning) (oss.OSS, error) {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewSupabaseStorage(oss.OSSArgs{Supabase: &oss.Supabase{
+		URL:          server.URL + "/",
+		ServiceKey:   "service-key",
+		Bucket:       "dify",
+		Provisioning: provisioning,
+	}})
+}
+
+func TestSupabaseStorage(t *testing.T) {
+	fake := &fakeSupabase{exists: true, objects: map[string][]byte{}}
+	storage, err := newStorage(t, fake, oss.BucketProvisioning{})
+	assert.Nil(t, err)
+	// page the listings by two
+	storage.(*SupabaseStorage).listLimit = 2
+	assert.Equal(t, oss.OSS_TYPE_SUPABASE, storage.Type())
+
+	exists, err := storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = storage.Load("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+	_, err = storage.State("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+
+	for _, key := range []string{"plugins/a.pkg", "plugins/b.pkg", "plugins/c/d.pkg", "plugins/c/e f.pkg", "pluginsx"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+	// the placeholders of the empty folders are not listed
+	fake.mu.Lock()
+	fake.objects["plugins/c/"+emptyFolderPlaceholder] = nil
+	fake.mu.Unlock()
+	// saving again replaces the object
+	assert.Nil(t, storage.Save("plugins/a.pkg", []byte("new")))
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), data)
+	exists, err = storage.Exists("plugins/c/e f.pkg")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	state, err := storage.State("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSSState{Size: 3, LastModified: modified, ETag: "etag-plugins/a.pkg"}, state)
+
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "b.pkg"}, {Path: "c/d.pkg"}, {Path: "c/e f.pkg"}}, paths)
+	paths, err = storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(paths))
+
+	// a 400 of HEAD is only a missing object if the object info says so
+	fake.mu.Lock()
+	fake.forbidden = "plugins/b"
+	fake.mu.Unlock()
+	_, err = storage.Exists("plugins/b.pkg")
+	assert.Equal(t, errclass.Permission, errclass.Classify(err))
+	fake.mu.Lock()
+	fake.forbidden = ""
+	fake.mu.Unlock()
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	exists, err = storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestSupabaseProvisioning(t *testing.T) {
+	fake := &fakeSupabase{objects: map[string][]byte{}}
+	_, err := newStorage(t, fake, oss.BucketProvisioning{Policy: oss.BucketPolicyRequireExisting})
+	assert.NotNil(t, err)
+
+	_, err = newStorage(t, fake, oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing, Versioning: true})
+	assert.NotNil(t, err)
+
+	_, err = newStorage(t, fake, oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing, ACL: "public-read"})
+	assert.Nil(t, err)
+	assert.True(t, fake.exists)
+	assert.True(t, fake.public)
+}
+
+func TestSupabaseWrappedErrors(t *testing.T) {
+	err := fmt.Errorf("load plugins/a.pkg: %w", &Error{StatusCode: http.StatusNotFound})
+	assert.True(t, isNotFound(err))
+	assert.False(t, isNotFound(fmt.Errorf("save: %w", &Error{StatusCode: http.StatusForbidden})))
+}
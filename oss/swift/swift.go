@@ -0,0 +1,332 @@
+package swift
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
+	"github.com/ncw/swift/v2"
+)
+
+const (
+	defaultLargeObjectThreshold = 1 << 30
+	defaultSegmentSize          = 100 << 20
+)
+
+// SwiftStorage stores the objects in a container of OpenStack Swift, the
+// connection authenticates with Keystone v3 and gets a new token when the
+// current one expires or is rejected
+type SwiftStorage struct {
+	container            string
+	largeObjectThreshold int64
+	segmentSize          int64
+	conn                 *swift.Connection
+	ctx                  context.Context
+}
+
+func NewSwiftStorage(args oss.OSSArgs) (oss.OSS, error) {
+	if args.OpenStackSwift == nil {
+		return nil, oss.ErrArgumentInvalid.WithDetail("can't find OpenStack Swift argument in OSSArgs")
+	}
+
+	err := args.OpenStackSwift.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &swift.Connection{
+		AuthVersion:  3,
+		AuthUrl:      args.OpenStackSwift.AuthURL,
+		UserName:     args.OpenStackSwift.UserName,
+		ApiKey:       args.OpenStackSwift.Password,
+		Domain:       args.OpenStackSwift.UserDomain,
+		Tenant:       args.OpenStackSwift.Project,
+		TenantDomain: args.OpenStackSwift.ProjectDomain,
+		Region:       args.OpenStackSwift.Region,
+		EndpointType: swift.EndpointType(args.OpenStackSwift.EndpointType),
+	}
+
+	httpClient, err := args.OpenStackSwift.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		conn.Transport = oss.RoundTripper(httpClient)
+		if httpClient.Timeout > 0 {
+			conn.Timeout = httpClient.Timeout
+		}
+	}
+
+	err = conn.Authenticate(context.Background())
+	if err != nil {
+		return nil, oss.ErrProviderInit.WithError(err).WithDetail("failed to authenticate with keystone")
+	}
+
+	storage := &SwiftStorage{
+		container:            args.OpenStackSwift.Container,
+		largeObjectThreshold: args.OpenStackSwift.LargeObjectThreshold,
+		segmentSize:          args.OpenStackSwift.SegmentSize,
+		conn:                 conn,
+		ctx:                  context.Background(),
+	}
+	if storage.largeObjectThreshold == 0 {
+		storage.largeObjectThreshold = defaultLargeObjectThreshold
+	}
+	if storage.segmentSize == 0 {
+		storage.segmentSize = defaultSegmentSize
+	}
+	err = storage.EnsureBucket(args.OpenStackSwift.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.OpenStackSwift.Prefix)
+}
+
+// EnsureBucket applies the provisioning to the container, a public-read
+// container can be read and listed anonymously and versioning needs a
+// cluster with object versioning enabled
+func (s *SwiftStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(s.container, s.containerExists, func() error {
+		return s.createContainer(provisioning)
+	})
+}
+
+func (s *SwiftStorage) containerExists() (bool, error) {
+	_, _, err := s.conn.Container(context.Background(), s.container)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SwiftStorage) createContainer(provisioning oss.BucketProvisioning) error {
+	headers := swift.Headers{}
+	switch provisioning.ACL {
+	case "", "private":
+	case "public-read":
+		headers["X-Container-Read"] = ".r:*,.rlistings"
+	default:
+		return oss.ErrArgumentInvalid.Errorf("unknown acl %q, swift supports private and public-read", provisioning.ACL)
+	}
+	if provisioning.Versioning {
+		headers["X-Versions-Enabled"] = "true"
+	}
+	return s.conn.ContainerCreate(context.Background(), s.container, headers)
+}
+
+// segmentContainer keeps the segments of the large objects out of the listings
+func (s *SwiftStorage) segmentContainer() string {
+	return s.container + "_segments"
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *SwiftStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
+// Save uploads data larger than the threshold as a static large object. The
+// segments of a new large object are uploaded under a fresh prefix and the
+// manifest replaces the object last, so a failed upload keeps the previous
+// version. The segments of the previous version are deleted afterwards, they
+// are left behind if that fails since the object is already saved.
+func (s *SwiftStorage) Save(key string, data []byte) error {
+	segmentContainer, segments, err := s.largeObjectSegments(key)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(data)) <= s.largeObjectThreshold {
+		err = s.conn.ObjectPutBytes(s.ctx, s.container, key, data, "")
+	} else {
+		err = s.saveLargeObject(key, data)
+	}
+	if err != nil {
+		return err
+	}
+	s.deleteObjects(segmentContainer, segments)
+	return nil
+}
+
+// saveLargeObject uploads the segments and a manifest to the segment
+// container and moves the manifest over key once the upload succeeded
+func (s *SwiftStorage) saveLargeObject(key string, data []byte) error {
+	err := s.conn.ContainerCreate(s.ctx, s.segmentContainer(), nil)
+	if err != nil {
+		return err
+	}
+	upload := fmt.Sprintf("%s/%d", key, time.Now().UnixNano())
+	file, err := s.conn.StaticLargeObjectCreate(s.ctx, &swift.LargeObjectOpts{
+		Container:        s.segmentContainer(),
+		ObjectName:       upload,
+		ChunkSize:        s.segmentSize,
+		SegmentContainer: s.segmentContainer(),
+		SegmentPrefix:    upload,
+		NoBuffer:         true,
+	})
+	if err == nil {
+		_, err = io.Copy(file, bytes.NewReader(data))
+		if err == nil {
+			err = file.CloseWithContext(s.ctx)
+		}
+	}
+	if err == nil {
+		err = s.conn.StaticLargeObjectMove(s.ctx, s.segmentContainer(), upload, s.container, key)
+	}
+	if err != nil {
+		// the segments of the failed upload are not referenced by key
+		s.deleteUpload(upload)
+		return err
+	}
+	return nil
+}
+
+// deleteUpload deletes the manifest and the segments of an upload, errors
+// are ignored since the upload already failed
+func (s *SwiftStorage) deleteUpload(upload string) {
+	names, err := s.conn.ObjectNamesAll(s.ctx, s.segmentContainer(), &swift.ObjectsOpts{Prefix: upload})
+	if err != nil {
+		return
+	}
+	segments := make([]swift.Object, 0, len(names))
+	for _, name := range names {
+		if name == upload || strings.HasPrefix(name, upload+"/") {
+			segments = append(segments, swift.Object{Name: name})
+		}
+	}
+	s.deleteObjects(s.segmentContainer(), segments)
+}
+
+// largeObjectSegments returns the segments of key if it is a large object
+func (s *SwiftStorage) largeObjectSegments(key string) (string, []swift.Object, error) {
+	_, headers, err := s.conn.Object(s.ctx, s.container, key)
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	if !headers.IsLargeObject() {
+		return "", nil, nil
+	}
+	return s.conn.LargeObjectGetSegments(s.ctx, s.container, key)
+}
+
+func (s *SwiftStorage) deleteObjects(container string, objects []swift.Object) error {
+	for _, object := range objects {
+		err := s.conn.ObjectDelete(s.ctx, container, object.Name)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SwiftStorage) Load(key string) ([]byte, error) {
+	return s.conn.ObjectGetBytes(s.ctx, s.container, key)
+}
+
+func (s *SwiftStorage) Exists(key string) (bool, error) {
+	_, _, err := s.conn.Object(s.ctx, s.container, key)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SwiftStorage) State(key string) (oss.OSSState, error) {
+	info, _, err := s.conn.Object(s.ctx, s.container, key)
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	return oss.OSSState{
+		Size:         info.Bytes,
+		LastModified: info.LastModified,
+		ETag:         info.Hash,
+	}, nil
+}
+
+func (s *SwiftStorage) List(prefix string) ([]oss.OSSPath, error) {
+	// append a slash to the prefix if it doesn't end with one, an empty prefix lists the container
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	objects, err := s.conn.ObjectsAll(s.ctx, s.container, &swift.ObjectsOpts{Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]oss.OSSPath, 0, len(objects))
+	for _, obj := range objects {
+		// remove prefix
+		key := strings.TrimPrefix(obj.Name, prefix)
+		// remove leading slash
+		key = strings.TrimPrefix(key, "/")
+		if key == "" {
+			continue
+		}
+		keys = append(keys, oss.OSSPath{
+			Path:  key,
+			IsDir: false,
+		})
+	}
+	return keys, nil
+}
+
+// ListDir implements oss.DirLister with the delimiter /, the pseudo
+// directories are returned with IsDir and without the trailing slash
+func (s *SwiftStorage) ListDir(prefix string) ([]oss.OSSPath, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	objects, err := s.conn.ObjectsAll(s.ctx, s.container, &swift.ObjectsOpts{Prefix: prefix, Delimiter: '/'})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]oss.OSSPath, 0, len(objects))
+	for _, obj := range objects {
+		key := strings.TrimSuffix(strings.TrimPrefix(obj.Name, prefix), "/")
+		if key == "" {
+			continue
+		}
+		keys = append(keys, oss.OSSPath{
+			Path:  key,
+			IsDir: obj.PseudoDirectory,
+		})
+	}
+	return keys, nil
+}
+
+// Delete removes the segments of a large object too, it succeeds if the
+// object does not exist
+func (s *SwiftStorage) Delete(key string) error {
+	err := s.conn.LargeObjectDelete(s.ctx, s.container, key)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *SwiftStorage) Type() string {
+	return oss.OSS_TYPE_SWIFT
+}
+
+func isNotFound(err error) bool {
+	var swiftErr *swift.Error
+	return errors.As(err, &swiftErr) && swiftErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,404 @@
+package swift
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/ncw/swift/v2/swifttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKeystone serves the Keystone v3 token API in front of the swifttest
+// server, every token is a new session of swifttest and the object-store
+// endpoint of the catalog is a proxy recording the requests to Swift
+type fakeKeystone struct {
+	mu       sync.Mutex
+	swift    *swifttest.SwiftServer
+	proxy    *httptest.Server
+	ttl      time.Duration
+	auths    int
+	requests []*http.Request
+	// fail answers the matching requests to Swift with a 503
+	fail func(r *http.Request) bool
+}
+
+func newFakeKeystone(t *testing.T) *fakeKeystone {
+	server, err := swifttest.NewSwiftServer("localhost")
+	assert.Nil(t, err)
+	t.Cleanup(server.Close)
+
+	f := &fakeKeystone{swift: server, ttl: time.Hour}
+	// the proxy forwards /info too, which is outside of the storage url
+	target, _ := url.Parse(server.URL)
+	target.Path = ""
+	forward := httputil.NewSingleHostReverseProxy(target)
+	f.proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Clone(r.Context()))
+		fail := f.fail
+		f.mu.Unlock()
+		if fail != nil && fail(r) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// swifttest keeps the metadata of an overwritten object, Swift drops
+		// it, so a plain object would still be served as a large object
+		if r.Method == http.MethodPut && r.URL.Query().Get("multipart-manifest") == "" && strings.Count(r.URL.Path, "/") >= 4 {
+			del, _ := http.NewRequest(http.MethodDelete, server.URL+r.URL.Path, nil)
+			del.Header.Set("X-Auth-Token", r.Header.Get("X-Auth-Token"))
+			if resp, err := http.DefaultClient.Do(del); err == nil {
+				resp.Body.Close()
+			}
+		}
+		forward.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.proxy.Close)
+	return f
+}
+
+func (f *fakeKeystone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v3/auth/tokens" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body := struct {
+		Auth struct {
+			Identity struct {
+				Password struct {
+					User struct {
+						Name     string
+						Password string
+						Domain   struct{ Name string }
+					}
+				}
+			}
+			Scope struct {
+				Project struct {
+					Name   string
+					Domain struct{ Name string }
+				}
+			}
+		}
+	}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	user := body.Auth.Identity.Password.User
+	project := body.Auth.Scope.Project
+	if user.Name != "dify" || user.Password != "secret" || user.Domain.Name != "users" ||
+		project.Name != "plugins" || project.Domain.Name != "projects" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// every token of keystone is a session of swifttest
+	req, _ := http.NewRequest(http.MethodGet, f.swift.AuthURL, nil)
+	req.Header.Set("X-Auth-User", swifttest.TEST_ACCOUNT)
+	req.Header.Set("X-Auth-Key", swifttest.TEST_ACCOUNT)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Body.Close()
+
+	f.mu.Lock()
+	f.auths++
+	ttl := f.ttl
+	f.mu.Unlock()
+
+	storageURL := strings.Replace(resp.Header.Get("X-Storage-Url"), f.swift.URL, f.proxy.URL+"/v1", 1)
+	w.Header().Set("X-Subject-Token", resp.Header.Get("X-Auth-Token"))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"token": map[string]any{
+			"expires_at": time.Now().Add(ttl).UTC().Format(time.RFC3339),
+			"catalog": []map[string]any{{
+				"type": "object-store",
+				"endpoints": []map[string]any{
+					{"interface": "internal", "region": "RegionOne", "url": "http://127.0.0.1:1/internal"},
+					{"interface": "public", "region": "RegionTwo", "url": "http://127.0.0.1:1/other"},
+					{"interface": "public", "region": "RegionOne", "url": storageURL},
+				},
+			}},
+		},
+	})
+}
+
+func (f *fakeKeystone) authCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.auths
+}
+
+func newArgs(t *testing.T, keystone *fakeKeystone) *oss.OpenStackSwift {
+	server := httptest.NewServer(keystone)
+	t.Cleanup(server.Close)
+	return &oss.OpenStackSwift{
+		AuthURL:       server.URL + "/v3",
+		UserName:      "dify",
+		Password:      "secret",
+		UserDomain:    "users",
+		Project:       "plugins",
+		ProjectDomain: "projects",
+		Region:        "RegionOne",
+		Container:     "dify",
+		Provisioning:  oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing},
+	}
+}
+
+func TestSwiftStorage(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	storage, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: newArgs(t, keystone)})
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSS_TYPE_SWIFT, storage.Type())
+
+	exists, err := storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = storage.Load("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+	_, err = storage.State("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+
+	for _, key := range []string{"plugins/a.pkg", "plugins/b.pkg", "plugins/c/d.pkg", "pluginsx"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("plugins/a.pkg"), data)
+
+	state, err := storage.State("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(13), state.Size)
+	assert.NotEmpty(t, state.ETag)
+	assert.False(t, state.LastModified.IsZero())
+
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "b.pkg"}, {Path: "c/d.pkg"}}, paths)
+
+	dirs, err := oss.ListDir(storage, "plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "b.pkg"}, {Path: "c", IsDir: true}}, dirs)
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	exists, err = storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestSwiftListDirWithPrefix(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	args := newArgs(t, keystone)
+	args.Prefix = "tenant"
+	storage, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.Nil(t, err)
+	_, ok := storage.(oss.DirLister)
+	assert.True(t, ok)
+
+	for _, key := range []string{"plugins/a.pkg", "plugins/c/d.pkg", "root.pkg"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+	dirs, err := oss.ListDir(storage, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "plugins", IsDir: true}, {Path: "root.pkg"}}, dirs)
+	dirs, err = oss.ListDir(storage, "plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.pkg"}, {Path: "c", IsDir: true}}, dirs)
+}
+
+func TestSwiftLargeObject(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	args := newArgs(t, keystone)
+	args.LargeObjectThreshold = 10
+	args.SegmentSize = 4
+	storage, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.Nil(t, err)
+
+	data := bytes.Repeat([]byte("0123456789"), 3)
+	assert.Nil(t, storage.Save("big.bin", data))
+	assert.Nil(t, storage.Save("small.bin", []byte("small")))
+
+	loaded, err := storage.Load("big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, data, loaded)
+	state, err := storage.State("big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)), state.Size)
+
+	// the segments are kept out of the container
+	paths, err := storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "big.bin"}, {Path: "small.bin"}}, paths)
+	segments, err := storage.(*SwiftStorage).conn.ObjectNamesAll(storage.(*SwiftStorage).ctx, "dify_segments", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(segments))
+
+	assert.Nil(t, storage.Delete("big.bin"))
+	segments, err = storage.(*SwiftStorage).conn.ObjectNamesAll(storage.(*SwiftStorage).ctx, "dify_segments", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, segments)
+	exists, err := storage.Exists("big.bin")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestSwiftLargeObjectOverwrite(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	args := newArgs(t, keystone)
+	args.LargeObjectThreshold = 10
+	args.SegmentSize = 4
+	storage, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.Nil(t, err)
+	conn, ctx := storage.(*SwiftStorage).conn, storage.(*SwiftStorage).ctx
+
+	old := bytes.Repeat([]byte("0123456789"), 3)
+	assert.Nil(t, storage.Save("big.bin", old))
+
+	// a failed upload keeps the previous version and leaves no segments
+	keystone.mu.Lock()
+	puts := 0
+	keystone.fail = func(r *http.Request) bool {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/dify_segments/") {
+			puts++
+			return puts > 2
+		}
+		return false
+	}
+	keystone.mu.Unlock()
+	assert.NotNil(t, storage.Save("big.bin", bytes.Repeat([]byte("abcdefghij"), 3)))
+	keystone.mu.Lock()
+	keystone.fail = nil
+	keystone.mu.Unlock()
+
+	data, err := storage.Load("big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, old, data)
+	segments, err := conn.ObjectNamesAll(ctx, "dify_segments", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(segments))
+
+	// the segments of the previous version are replaced
+	data = bytes.Repeat([]byte("abcdefghij"), 2)
+	assert.Nil(t, storage.Save("big.bin", data))
+	loaded, err := storage.Load("big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, data, loaded)
+	segments, err = conn.ObjectNamesAll(ctx, "dify_segments", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(segments))
+
+	// overwriting with a small object deletes the segments
+	assert.Nil(t, storage.Save("big.bin", []byte("small")))
+	loaded, err = storage.Load("big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("small"), loaded)
+	segments, err = conn.ObjectNamesAll(ctx, "dify_segments", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, segments)
+
+	// a failed deletion of the previous segments does not fail the save
+	assert.Nil(t, storage.Save("big.bin", old))
+	keystone.mu.Lock()
+	keystone.fail = func(r *http.Request) bool {
+		return r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/dify_segments/")
+	}
+	keystone.mu.Unlock()
+	assert.Nil(t, storage.Save("big.bin", []byte("small")))
+	keystone.mu.Lock()
+	keystone.fail = nil
+	keystone.mu.Unlock()
+	loaded, err = storage.Load("big.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("small"), loaded)
+	segments, err = conn.ObjectNamesAll(ctx, "dify_segments", nil)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, segments)
+}
+
+func TestSwiftTokenRefresh(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	storage, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: newArgs(t, keystone)})
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Save("a.pkg", []byte("a")))
+	assert.Equal(t, 1, keystone.authCount())
+
+	// a revoked token is rejected with 401 and replaced
+	keystone.swift.Lock()
+	for id := range keystone.swift.Sessions {
+		delete(keystone.swift.Sessions, id)
+	}
+	keystone.swift.Unlock()
+	data, err := storage.Load("a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+	assert.Equal(t, 2, keystone.authCount())
+}
+
+func TestSwiftTokenExpiry(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	// tokens are replaced once they expire within a minute
+	keystone.ttl = time.Minute + time.Second
+	storage, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: newArgs(t, keystone)})
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Save("a.pkg", []byte("a")))
+	assert.Equal(t, 1, keystone.authCount())
+
+	time.Sleep(1100 * time.Millisecond)
+	data, err := storage.Load("a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), data)
+	assert.Equal(t, 2, keystone.authCount())
+}
+
+func TestSwiftProvisioning(t *testing.T) {
+	keystone := newFakeKeystone(t)
+	args := newArgs(t, keystone)
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyRequireExisting}
+	_, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.NotNil(t, err)
+
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing, ACL: "world"}
+	_, err = NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.NotNil(t, err)
+
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing, ACL: "public-read", Versioning: true}
+	_, err = NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.Nil(t, err)
+
+	var create *http.Request
+	for _, r := range keystone.requests {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/dify") {
+			create = r
+		}
+	}
+	assert.NotNil(t, create)
+	assert.Equal(t, ".r:*,.rlistings", create.Header.Get("X-Container-Read"))
+	assert.Equal(t, "true", create.Header.Get("X-Versions-Enabled"))
+
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyRequireExisting}
+	_, err = NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.Nil(t, err)
+}
+
+func TestSwiftAuthFailure(t *testing.T) {
+	args := newArgs(t, newFakeKeystone(t))
+	args.Password = "wrong"
+	_, err := NewSwiftStorage(oss.OSSArgs{OpenStackSwift: args})
+	assert.NotNil(t, err)
+
+	_, err = NewSwiftStorage(oss.OSSArgs{OpenStackSwift: &oss.OpenStackSwift{AuthURL: "http://localhost/v3", Container: "dify"}})
+	assert.NotNil(t, err)
+}
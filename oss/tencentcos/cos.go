@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 	"github.com/tencentyun/cos-go-sdk-v5"
 )
 
@@ -17,6 +18,7 @@ type TencentCOSStorage struct {
 	bucket string
 	region string
 	client *cos.Client
+	ctx    context.Context
 }
 
 func NewTencentCOSStorage(args oss.OSSArgs) (oss.OSS, error) {
@@ -42,33 +44,94 @@ func NewTencentCOSStorage(args oss.OSSArgs) (oss.OSS, error) {
 		return nil, oss.ErrProviderInit.WithError(err).WithDetail("url parse failed")
 	}
 
+	httpClient, err := args.TencentCOS.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	// the sdk defaults are kept when no transport is configured
+	var transport http.RoundTripper
+	var timeout time.Duration
+	if httpClient != nil {
+		transport = oss.RoundTripper(httpClient)
+		timeout = httpClient.Timeout
+	}
+
 	b := &cos.BaseURL{BucketURL: u}
 	client := cos.NewClient(b, &http.Client{
 		Transport: &cos.AuthorizationTransport{
 			SecretID:  secretID,
 			SecretKey: secretKey,
+			Transport: transport,
 		},
+		Timeout: timeout,
 	})
 
-	_, err = client.Bucket.Head(context.Background())
-	if err != nil {
-		return nil, oss.ErrProviderInit.WithError(err)
-	}
-
-	return &TencentCOSStorage{
+	storage := &TencentCOSStorage{
 		bucket: bucket,
 		region: region,
 		client: client,
-	}, nil
+		ctx:    context.Background(),
+	}
+	err = storage.EnsureBucket(args.TencentCOS.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	// without a policy the bucket is still checked, so a wrong bucket or
+	// wrong credentials fail the initialization, unless the bucket is
+	// provisioned afterwards
+	provisioning := args.TencentCOS.Provisioning
+	if !provisioning.Deferred() && (provisioning.Policy == "" || provisioning.Policy == oss.BucketPolicyNever) {
+		_, err = client.Bucket.Head(context.Background())
+		if err != nil {
+			return nil, oss.ErrProviderInit.WithError(err)
+		}
+	}
+	return prefix.Wrap(storage, args.TencentCOS.Prefix)
+}
+
+// EnsureBucket applies the provisioning to the bucket, the region of a new
+// bucket is always the one of the bucket url, so a different Region is rejected
+func (s *TencentCOSStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	if err := provisioning.CheckRegion(s.region); err != nil {
+		return err
+	}
+	return provisioning.Ensure(s.bucket, func() (bool, error) {
+		return s.client.Bucket.IsExist(context.Background())
+	}, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *TencentCOSStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	_, err := s.client.Bucket.Put(context.Background(), &cos.BucketPutOptions{
+		XCosACL: provisioning.ACL,
+	})
+	if err != nil {
+		return err
+	}
+
+	if provisioning.Versioning {
+		_, err = s.client.Bucket.PutVersioning(context.Background(), &cos.BucketPutVersionOptions{
+			Status: "Enabled",
+		})
+	}
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *TencentCOSStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
 }
 
 func (s *TencentCOSStorage) Save(key string, data []byte) error {
-	_, err := s.client.Object.Put(context.Background(), key, bytes.NewReader(data), nil)
+	_, err := s.client.Object.Put(s.ctx, key, bytes.NewReader(data), nil)
 	return err
 }
 
 func (s *TencentCOSStorage) Load(key string) ([]byte, error) {
-	resp, err := s.client.Object.Get(context.Background(), key, nil)
+	resp, err := s.client.Object.Get(s.ctx, key, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +140,7 @@ func (s *TencentCOSStorage) Load(key string) ([]byte, error) {
 }
 
 func (s *TencentCOSStorage) Exists(key string) (bool, error) {
-	ok, err := s.client.Object.IsExist(context.Background(), key)
+	ok, err := s.client.Object.IsExist(s.ctx, key)
 	if err == nil && ok {
 		return true, nil
 	} else if err != nil {
@@ -88,12 +151,12 @@ func (s *TencentCOSStorage) Exists(key string) (bool, error) {
 }
 
 func (s *TencentCOSStorage) Delete(key string) error {
-	_, err := s.client.Object.Delete(context.Background(), key)
+	_, err := s.client.Object.Delete(s.ctx, key)
 	return err
 }
 
 func (s *TencentCOSStorage) List(prefix string) ([]oss.OSSPath, error) {
-	if !strings.HasSuffix(prefix, "/") {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 
@@ -109,7 +172,7 @@ func (s *TencentCOSStorage) List(prefix string) ([]oss.OSSPath, error) {
 			opt.Marker = marker
 		}
 
-		result, _, err := s.client.Bucket.Get(context.Background(), opt)
+		result, _, err := s.client.Bucket.Get(s.ctx, opt)
 		if err != nil {
 			return nil, err
 		}
@@ -159,7 +222,7 @@ func (s *TencentCOSStorage) List(prefix string) ([]oss.OSSPath, error) {
 }
 
 func (s *TencentCOSStorage) State(key string) (oss.OSSState, error) {
-	resp, err := s.client.Object.Head(context.Background(), key, nil)
+	resp, err := s.client.Object.Head(s.ctx, key, nil)
 	if err != nil {
 		return oss.OSSState{}, err
 	}
@@ -174,6 +237,7 @@ func (s *TencentCOSStorage) State(key string) (oss.OSSState, error) {
 	return oss.OSSState{
 		Size:         contentLength,
 		LastModified: lastModified,
+		ETag:         resp.Header.Get("ETag"),
 	}, nil
 }
 
@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/langgenius/dify-cloud-kit/oss/tracing"
+
+const (
+	AttributeType       = attribute.Key("oss.type")
+	AttributeBucket     = attribute.Key("oss.bucket")
+	AttributeOperation  = attribute.Key("oss.operation")
+	AttributeKey        = attribute.Key("oss.key")
+	AttributeSize       = attribute.Key("oss.object.size")
+	AttributeCount      = attribute.Key("oss.list.count")
+	AttributeErrorClass = attribute.Key("oss.error.class")
+)
+
+type Options struct {
+	// TracerProvider creates the tracer, the global provider is used by default
+	TracerProvider trace.TracerProvider
+	// Bucket is recorded on every span, the storage itself does not expose it
+	Bucket string
+	// HashKeys records the sha256 of the keys instead of the keys themselves
+	HashKeys bool
+}
+
+// TracingStorage creates a span for every operation of a storage, the spans
+// are children of the span in the context bound with WithContext
+type TracingStorage struct {
+	inner  oss.OSS
+	tracer trace.Tracer
+	opts   Options
+	ctx    context.Context
+}
+
+func NewTracingStorage(inner oss.OSS, opts Options) *TracingStorage {
+	provider := opts.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &TracingStorage{
+		inner:  inner,
+		tracer: provider.Tracer(instrumentationName),
+		opts:   opts,
+		ctx:    context.Background(),
+	}
+}
+
+func (t *TracingStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *t
+	storage.ctx = ctx
+	return &storage
+}
+
+func (t *TracingStorage) Unwrap() oss.OSS {
+	return t.inner
+}
+
+// start starts the span of an operation and returns the inner storage bound to the span
+func (t *TracingStorage) start(op oss.Operation, key string) (oss.OSS, trace.Span) {
+	if t.opts.HashKeys {
+		sum := sha256.Sum256([]byte(key))
+		key = hex.EncodeToString(sum[:])
+	}
+	attributes := []attribute.KeyValue{
+		AttributeType.String(t.inner.Type()),
+		AttributeOperation.String(string(op)),
+		AttributeKey.String(key),
+	}
+	if t.opts.Bucket != "" {
+		attributes = append(attributes, AttributeBucket.String(t.opts.Bucket))
+	}
+
+	ctx, span := t.tracer.Start(t.ctx, "oss."+string(op),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+	return oss.WithContext(ctx, t.inner), span
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(AttributeErrorClass.String(string(errclass.Classify(err))))
+	}
+	span.End()
+}
+
+func (t *TracingStorage) Save(key string, data []byte) error {
+	inner, span := t.start(oss.OperationSave, key)
+	span.SetAttributes(AttributeSize.Int(len(data)))
+	err := inner.Save(key, data)
+	end(span, err)
+	return err
+}
+
+func (t *TracingStorage) Load(key string) ([]byte, error) {
+	inner, span := t.start(oss.OperationLoad, key)
+	data, err := inner.Load(key)
+	if err == nil {
+		span.SetAttributes(AttributeSize.Int(len(data)))
+	}
+	end(span, err)
+	return data, err
+}
+
+func (t *TracingStorage) Exists(key string) (bool, error) {
+	inner, span := t.start(oss.OperationExists, key)
+	exists, err := inner.Exists(key)
+	end(span, err)
+	return exists, err
+}
+
+func (t *TracingStorage) State(key string) (oss.OSSState, error) {
+	inner, span := t.start(oss.OperationState, key)
+	state, err := inner.State(key)
+	if err == nil {
+		span.SetAttributes(AttributeSize.Int64(state.Size))
+	}
+	end(span, err)
+	return state, err
+}
+
+func (t *TracingStorage) List(prefix string) ([]oss.OSSPath, error) {
+	inner, span := t.start(oss.OperationList, prefix)
+	paths, err := inner.List(prefix)
+	if err == nil {
+		span.SetAttributes(AttributeCount.Int(len(paths)))
+	}
+	end(span, err)
+	return paths, err
+}
+
+func (t *TracingStorage) Delete(key string) error {
+	inner, span := t.start(oss.OperationDelete, key)
+	err := inner.Delete(key)
+	end(span, err)
+	return err
+}
+
+func (t *TracingStorage) Type() string {
+	return t.inner.Type()
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/local"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func TestTracingStorage(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	storage := NewTracingStorage(inner, Options{TracerProvider: provider, Bucket: "plugins"})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "install")
+	traced := oss.WithContext(ctx, storage)
+	assert.Nil(t, traced.Save("a/b", []byte("hello")))
+	_, err = traced.Load("a/missing")
+	assert.NotNil(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans().Snapshots()
+	assert.Equal(t, 3, len(spans))
+
+	save := spans[0]
+	assert.Equal(t, "oss.save", save.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), save.Parent().SpanID())
+	values := attributes(save)
+	assert.Equal(t, "local", values[AttributeType].AsString())
+	assert.Equal(t, "plugins", values[AttributeBucket].AsString())
+	assert.Equal(t, "a/b", values[AttributeKey].AsString())
+	assert.Equal(t, int64(5), values[AttributeSize].AsInt64())
+
+	load := spans[1]
+	assert.Equal(t, "oss.load", load.Name())
+	assert.Equal(t, codes.Error, load.Status().Code)
+	assert.Equal(t, "not_found", attributes(load)[AttributeErrorClass].AsString())
+}
+
+func TestTracingStorageHashKeys(t *testing.T) {
+	inner, err := local.NewLocalStorage(oss.OSSArgs{Local: &oss.Local{Path: t.TempDir()}})
+	assert.Nil(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	storage := NewTracingStorage(inner, Options{TracerProvider: provider, HashKeys: true})
+
+	_, err = storage.Exists("secret/key")
+	assert.Nil(t, err)
+
+	sum := sha256.Sum256([]byte("secret/key"))
+	spans := exporter.GetSpans().Snapshots()
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, hex.EncodeToString(sum[:]), attributes(spans[0])[AttributeKey].AsString())
+}
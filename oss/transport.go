@@ -0,0 +1,139 @@
+package oss
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Transport configures the http client used by the SDK of a driver,
+// a nil Transport keeps the defaults of the SDK
+type Transport struct {
+	// HTTPClient is used as it is when set, all the other fields are ignored
+	HTTPClient *http.Client
+
+	// ProxyURL is the proxy for all requests, the environment proxy is used if it's empty
+	ProxyURL string
+	// CABundleFile is a PEM file of the certificate authorities to trust
+	CABundleFile string
+	// ClientCertFile and ClientKeyFile are PEM files of the client certificate for mTLS
+	ClientCertFile     string
+	ClientKeyFile      string
+	InsecureSkipVerify bool
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	// RequestTimeout limits a whole request including reading the body
+	RequestTimeout time.Duration
+}
+
+func (t *Transport) Validate() error {
+	if t == nil || t.HTTPClient != nil {
+		return nil
+	}
+	if t.ProxyURL != "" {
+		if _, err := url.Parse(t.ProxyURL); err != nil {
+			return ErrArgumentInvalid.Errorf("proxy url is invalid").WithError(err)
+		}
+	}
+	if (t.ClientCertFile == "") != (t.ClientKeyFile == "") {
+		return ErrArgumentInvalid.Errorf("clientCertFile and clientKeyFile must be set together")
+	}
+	if t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 || t.MaxConnsPerHost < 0 {
+		return ErrArgumentInvalid.Errorf("connection pool sizes cannot be negative")
+	}
+	return nil
+}
+
+// Client builds the http client, it returns nil if the transport is nil
+func (t *Transport) Client() (*http.Client, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.HTTPClient != nil {
+		return t.HTTPClient, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if t.ProxyURL != "" {
+		proxy, err := url.Parse(t.ProxyURL)
+		if err != nil {
+			return nil, ErrProviderInit.Errorf("proxy url is invalid").WithError(err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CABundleFile != "" {
+		pem, err := os.ReadFile(t.CABundleFile)
+		if err != nil {
+			return nil, ErrProviderInit.Errorf("failed to read ca bundle").WithError(err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrProviderInit.Errorf("no certificate found in %s", t.CABundleFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+		if err != nil {
+			return nil, ErrProviderInit.Errorf("failed to load client certificate").WithError(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if t.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   t.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if t.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = t.TLSHandshakeTimeout
+	}
+	if t.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = t.ResponseHeaderTimeout
+	}
+	if t.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = t.IdleConnTimeout
+	}
+	if t.MaxIdleConns > 0 {
+		transport.MaxIdleConns = t.MaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	if t.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = t.MaxConnsPerHost
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   t.RequestTimeout,
+	}, nil
+}
+
+// RoundTripper returns the transport of the client, http.DefaultTransport is
+// used when the client has none
+func RoundTripper(client *http.Client) http.RoundTripper {
+	if client.Transport == nil {
+		return http.DefaultTransport
+	}
+	return client.Transport
+}
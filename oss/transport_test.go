@@ -0,0 +1,59 @@
+package oss
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportClientWithCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	assert.Nil(t, os.WriteFile(caFile, pem.EncodeToMemory(block), 0o644))
+
+	// the test server certificate is not trusted by default
+	client, err := (&Transport{}).Client()
+	assert.Nil(t, err)
+	_, err = client.Get(server.URL)
+	assert.NotNil(t, err)
+
+	client, err = (&Transport{
+		CABundleFile:    caFile,
+		MaxConnsPerHost: 4,
+		RequestTimeout:  5 * time.Second,
+	}).Client()
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+
+	resp, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestTransportClient(t *testing.T) {
+	var transport *Transport
+	client, err := transport.Client()
+	assert.Nil(t, err)
+	assert.Nil(t, client)
+
+	custom := &http.Client{}
+	client, err = (&Transport{HTTPClient: custom, ProxyURL: "::"}).Client()
+	assert.Nil(t, err)
+	assert.Same(t, custom, client)
+
+	assert.NotNil(t, (&Transport{ClientCertFile: "cert.pem"}).Validate())
+	assert.NotNil(t, (&Transport{ProxyURL: "http://[::1"}).Validate())
+	assert.Nil(t, (&Transport{ProxyURL: "http://proxy.internal:3128"}).Validate())
+}
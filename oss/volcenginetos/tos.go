@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
 	"github.com/volcengine/ve-tos-golang-sdk/v2/tos"
+	"github.com/volcengine/ve-tos-golang-sdk/v2/tos/enum"
 	"io"
 	"strings"
 )
 
 type VolcengineTOSStorage struct {
 	bucket string
+	region string
 	client *tos.ClientV2
+	ctx    context.Context
 }
 
 func NewVolcengineTOSStorage(args oss.OSSArgs) (oss.OSS, error) {
@@ -30,21 +34,88 @@ func NewVolcengineTOSStorage(args oss.OSSArgs) (oss.OSS, error) {
 	endpoint := args.VolcengineTOS.Endpoint
 	region := args.VolcengineTOS.Region
 
-	client, err := tos.NewClientV2(endpoint,
+	httpClient, err := args.VolcengineTOS.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	options := []tos.ClientOption{
 		tos.WithRegion(region),
 		tos.WithCredentials(tos.NewStaticCredentials(accessKey, secretKey)),
-	)
+	}
+	if httpClient != nil {
+		options = append(options, tos.WithHTTPTransport(oss.RoundTripper(httpClient)))
+		if httpClient.Timeout > 0 {
+			options = append(options, tos.WithRequestTimeout(httpClient.Timeout))
+		}
+	}
+	client, err := tos.NewClientV2(endpoint, options...)
 	if err != nil {
 		return nil, oss.ErrProviderInit.WithError(err)
 	}
-	return &VolcengineTOSStorage{
+	storage := &VolcengineTOSStorage{
 		bucket: bucket,
+		region: region,
 		client: client,
-	}, nil
+		ctx:    context.Background(),
+	}
+	err = storage.EnsureBucket(args.VolcengineTOS.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.VolcengineTOS.Prefix)
+}
+
+// EnsureBucket applies the provisioning to the bucket, the region of a new
+// bucket is always the one of the client, so a different Region is rejected
+func (s *VolcengineTOSStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	if err := provisioning.CheckRegion(s.region); err != nil {
+		return err
+	}
+	return provisioning.Ensure(s.bucket, s.bucketExists, func() error {
+		return s.createBucket(provisioning)
+	})
+}
+
+func (s *VolcengineTOSStorage) bucketExists() (bool, error) {
+	_, err := s.client.HeadBucket(context.Background(), &tos.HeadBucketInput{
+		Bucket: s.bucket,
+	})
+	if err != nil {
+		if tosErr, ok := err.(*tos.TosServerError); ok && tosErr.StatusCode == 404 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *VolcengineTOSStorage) createBucket(provisioning oss.BucketProvisioning) error {
+	_, err := s.client.CreateBucketV2(context.Background(), &tos.CreateBucketV2Input{
+		Bucket: s.bucket,
+		ACL:    enum.ACLType(provisioning.ACL),
+	})
+	if err != nil {
+		return err
+	}
+
+	if provisioning.Versioning {
+		_, err = s.client.PutBucketVersioning(context.Background(), &tos.PutBucketVersioningInput{
+			Bucket: s.bucket,
+			Status: enum.VersioningStatusEnable,
+		})
+	}
+	return err
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *VolcengineTOSStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
 }
 
 func (s *VolcengineTOSStorage) Save(key string, data []byte) error {
-	_, err := s.client.PutObjectV2(context.Background(), &tos.PutObjectV2Input{
+	_, err := s.client.PutObjectV2(s.ctx, &tos.PutObjectV2Input{
 		PutObjectBasicInput: tos.PutObjectBasicInput{
 			Bucket: s.bucket,
 			Key:    key,
@@ -55,7 +126,7 @@ func (s *VolcengineTOSStorage) Save(key string, data []byte) error {
 }
 
 func (s *VolcengineTOSStorage) Load(key string) ([]byte, error) {
-	resp, err := s.client.GetObjectV2(context.Background(), &tos.GetObjectV2Input{
+	resp, err := s.client.GetObjectV2(s.ctx, &tos.GetObjectV2Input{
 		Bucket: s.bucket,
 		Key:    key,
 	})
@@ -66,7 +137,7 @@ func (s *VolcengineTOSStorage) Load(key string) ([]byte, error) {
 }
 
 func (s *VolcengineTOSStorage) Exists(key string) (bool, error) {
-	_, err := s.client.HeadObjectV2(context.Background(), &tos.HeadObjectV2Input{
+	_, err := s.client.HeadObjectV2(s.ctx, &tos.HeadObjectV2Input{
 		Bucket: s.bucket,
 		Key:    key,
 	})
@@ -80,7 +151,7 @@ func (s *VolcengineTOSStorage) Exists(key string) (bool, error) {
 }
 
 func (s *VolcengineTOSStorage) State(key string) (oss.OSSState, error) {
-	resp, err := s.client.HeadObjectV2(context.Background(), &tos.HeadObjectV2Input{
+	resp, err := s.client.HeadObjectV2(s.ctx, &tos.HeadObjectV2Input{
 		Bucket: s.bucket,
 		Key:    key,
 	})
@@ -90,11 +161,12 @@ func (s *VolcengineTOSStorage) State(key string) (oss.OSSState, error) {
 	return oss.OSSState{
 		Size:         resp.ContentLength,
 		LastModified: resp.LastModified,
+		ETag:         resp.ETag,
 	}, nil
 }
 
 func (s *VolcengineTOSStorage) List(prefix string) ([]oss.OSSPath, error) {
-	if !strings.HasSuffix(prefix, "/") {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 	var result []oss.OSSPath
@@ -102,7 +174,7 @@ func (s *VolcengineTOSStorage) List(prefix string) ([]oss.OSSPath, error) {
 	continuationToken := ""
 	for truncated {
 
-		resp, err := s.client.ListObjectsType2(context.Background(), &tos.ListObjectsType2Input{
+		resp, err := s.client.ListObjectsType2(s.ctx, &tos.ListObjectsType2Input{
 			Bucket:            s.bucket,
 			Prefix:            prefix,
 			MaxKeys:           1000,
@@ -134,7 +206,7 @@ func (s *VolcengineTOSStorage) List(prefix string) ([]oss.OSSPath, error) {
 }
 
 func (s *VolcengineTOSStorage) Delete(key string) error {
-	_, err := s.client.DeleteObjectV2(context.Background(), &tos.DeleteObjectV2Input{
+	_, err := s.client.DeleteObjectV2(s.ctx, &tos.DeleteObjectV2Input{
 		Bucket: s.bucket,
 		Key:    key,
 	})
@@ -0,0 +1,380 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/prefix"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop>
+<D:resourcetype/><D:getcontentlength/><D:getlastmodified/><D:getetag/>
+</D:prop></D:propfind>`
+
+// Error is returned for the responses which are not 2xx
+type Error struct {
+	StatusCode int
+	Method     string
+	Path       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("webdav: %s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *Error) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+func hasStatus(err error, status ...int) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, s := range status {
+		if e.StatusCode == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WebDAVStorage keeps the objects as files below the root collection, the
+// slashes of the keys are collections
+type WebDAVStorage struct {
+	endpoint string
+	// root is the unescaped path of the root collection with a trailing slash
+	root     string
+	username string
+	password string
+	client   *http.Client
+	ctx      context.Context
+}
+
+func NewWebDAVStorage(args oss.OSSArgs) (oss.OSS, error) {
+	if args.WebDAV == nil {
+		return nil, oss.ErrArgumentInvalid.WithDetail("can't find WebDAV argument in OSSArgs")
+	}
+
+	err := args.WebDAV.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := args.WebDAV.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	endpoint, _ := url.Parse(args.WebDAV.Endpoint)
+	root := strings.TrimSuffix(endpoint.Path, "/") + "/"
+	endpoint.Path, endpoint.RawPath = "", ""
+	storage := &WebDAVStorage{
+		endpoint: endpoint.String(),
+		root:     root,
+		username: args.WebDAV.Username,
+		password: args.WebDAV.Password,
+		client:   client,
+		ctx:      context.Background(),
+	}
+	err = storage.EnsureBucket(args.WebDAV.Provisioning)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.Wrap(storage, args.WebDAV.Prefix)
+}
+
+// EnsureBucket applies the provisioning to the root collection, ACL and
+// versioning are not supported by WebDAV
+func (s *WebDAVStorage) EnsureBucket(provisioning oss.BucketProvisioning) error {
+	return provisioning.Ensure(s.root, s.rootExists, func() error {
+		if provisioning.ACL != "" || provisioning.Versioning {
+			return oss.ErrArgumentInvalid.Errorf("webdav does not support acl and versioning")
+		}
+		return s.mkcol(context.Background(), s.root)
+	})
+}
+
+func (s *WebDAVStorage) rootExists() (bool, error) {
+	_, err := s.propfind(context.Background(), s.root, "0")
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// WithContext returns a copy of the storage whose requests are bound to ctx
+func (s *WebDAVStorage) WithContext(ctx context.Context) oss.OSS {
+	storage := *s
+	storage.ctx = ctx
+	return &storage
+}
+
+// resource returns the unescaped path of key, collections end with a slash
+func (s *WebDAVStorage) resource(key string, collection bool) string {
+	key = strings.Trim(key, "/")
+	if key == "" {
+		return s.root
+	}
+	if collection {
+		key += "/"
+	}
+	return s.root + key
+}
+
+// do sends a request and turns the responses which are not 2xx into *Error
+func (s *WebDAVStorage) do(ctx context.Context, method string, resource string, body []byte, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	target := (&url.URL{Path: resource}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil, &Error{StatusCode: resp.StatusCode, Method: method, Path: resource}
+}
+
+func (s *WebDAVStorage) discard(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// mkcol creates a collection, it succeeds if the collection exists
+func (s *WebDAVStorage) mkcol(ctx context.Context, resource string) error {
+	err := s.discard(s.do(ctx, "MKCOL", resource, nil, nil))
+	if hasStatus(err, http.StatusMethodNotAllowed) {
+		return nil
+	}
+	return err
+}
+
+// mkcolAll creates the collections above key from the top
+func (s *WebDAVStorage) mkcolAll(ctx context.Context, key string) error {
+	segments := strings.Split(strings.Trim(key, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		err := s.mkcol(ctx, s.resource(strings.Join(segments[:i], "/"), true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save creates the missing collections above key when the server reports
+// them with a 409, some servers answer with a 404 instead
+func (s *WebDAVStorage) Save(key string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	err := s.discard(s.do(s.ctx, http.MethodPut, s.resource(key, false), data, header))
+	if !hasStatus(err, http.StatusConflict, http.StatusNotFound) || !strings.Contains(strings.Trim(key, "/"), "/") {
+		return err
+	}
+	err = s.mkcolAll(s.ctx, key)
+	if err != nil {
+		return err
+	}
+	return s.discard(s.do(s.ctx, http.MethodPut, s.resource(key, false), data, header))
+}
+
+func (s *WebDAVStorage) Load(key string) ([]byte, error) {
+	resp, err := s.do(s.ctx, http.MethodGet, s.resource(key, false), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *WebDAVStorage) Exists(key string) (bool, error) {
+	err := s.discard(s.do(s.ctx, http.MethodHead, s.resource(key, false), nil, nil))
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Prop struct {
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ETag          string `xml:"DAV: getetag"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// entry is a resource of a PROPFIND response, path is unescaped
+type entry struct {
+	path       string
+	collection bool
+	state      oss.OSSState
+}
+
+// propfind returns the resources at depth 0 or 1 below resource
+func (s *WebDAVStorage) propfind(ctx context.Context, resource string, depth string) ([]entry, error) {
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := s.do(ctx, "PROPFIND", resource, []byte(propfindBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := multistatus{}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]entry, 0, len(result.Responses))
+	for _, r := range result.Responses {
+		// the href is an escaped path or an absolute url
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, err
+		}
+		e := entry{path: href.Path}
+		for _, propstat := range r.Propstats {
+			// the properties the server does not have are reported with a 404
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			prop := propstat.Prop
+			e.collection = e.collection || prop.ResourceType.Collection != nil
+			if prop.ContentLength != "" {
+				e.state.Size, _ = strconv.ParseInt(strings.TrimSpace(prop.ContentLength), 10, 64)
+			}
+			if prop.LastModified != "" {
+				e.state.LastModified, _ = time.Parse(http.TimeFormat, prop.LastModified)
+			}
+			if prop.ETag != "" {
+				e.state.ETag = prop.ETag
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *WebDAVStorage) State(key string) (oss.OSSState, error) {
+	entries, err := s.propfind(s.ctx, s.resource(key, false), "0")
+	if err != nil {
+		return oss.OSSState{}, err
+	}
+	if len(entries) == 0 {
+		return oss.OSSState{}, &Error{StatusCode: http.StatusNotFound, Method: "PROPFIND", Path: s.resource(key, false)}
+	}
+	return entries[0].state, nil
+}
+
+// List walks the collections below prefix with PROPFIND at depth 1, since
+// many servers refuse the infinite depth. The collections are returned too
+// with IsDir like the local storage.
+func (s *WebDAVStorage) List(prefix string) ([]oss.OSSPath, error) {
+	keys := make([]oss.OSSPath, 0)
+	collection := s.resource(prefix, true)
+	err := s.walk(collection, collection, &keys)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return keys, nil
+		}
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Path < keys[j].Path
+	})
+	return keys, nil
+}
+
+func (s *WebDAVStorage) walk(base string, collection string, keys *[]oss.OSSPath) error {
+	entries, err := s.propfind(s.ctx, collection, "1")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		// the response includes the collection itself
+		if path.Clean(e.path) == path.Clean(collection) {
+			continue
+		}
+		key, ok := strings.CutPrefix(e.path, base)
+		key = strings.Trim(key, "/")
+		if !ok || key == "" {
+			continue
+		}
+		*keys = append(*keys, oss.OSSPath{
+			Path:  key,
+			IsDir: e.collection,
+		})
+		if e.collection {
+			err := s.walk(base, s.resource(strings.TrimPrefix(e.path, s.root), true), keys)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete succeeds if the object does not exist
+func (s *WebDAVStorage) Delete(key string) error {
+	err := s.discard(s.do(s.ctx, http.MethodDelete, s.resource(key, false), nil, nil))
+	if hasStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *WebDAVStorage) Type() string {
+	return oss.OSS_TYPE_WEBDAV
+}
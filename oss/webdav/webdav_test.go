@@ -0,0 +1,141 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/webdav"
+)
+
+// newServer serves an in-memory file system below /dav with basic auth
+func newServer(t *testing.T, root bool) *httptest.Server {
+	fs := webdav.NewMemFS()
+	if root {
+		assert.Nil(t, fs.Mkdir(context.Background(), "/dify", 0777))
+	}
+	handler := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "dify" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebDAVStorage(t *testing.T) {
+	server := newServer(t, true)
+	storage, err := NewWebDAVStorage(oss.OSSArgs{WebDAV: &oss.WebDAV{
+		Endpoint: server.URL + "/dav/dify",
+		Username: "dify",
+		Password: "secret",
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, oss.OSS_TYPE_WEBDAV, storage.Type())
+
+	exists, err := storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = storage.Load("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+	_, err = storage.State("plugins/a.pkg")
+	assert.True(t, errclass.IsNotFound(err))
+
+	// the collections above the keys are created on the way
+	for _, key := range []string{"plugins/a.pkg", "plugins/b.pkg", "plugins/c/d e.pkg", "pluginsx"} {
+		assert.Nil(t, storage.Save(key, []byte(key)))
+	}
+	assert.Nil(t, storage.Save("plugins/a.pkg", []byte("new")))
+
+	data, err := storage.Load("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), data)
+	exists, err = storage.Exists("plugins/c/d e.pkg")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	state, err := storage.State("plugins/c/d e.pkg")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(17), state.Size)
+	assert.NotEmpty(t, state.ETag)
+	assert.False(t, state.LastModified.IsZero())
+
+	paths, err := storage.List("plugins")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{
+		{Path: "a.pkg"},
+		{Path: "b.pkg"},
+		{Path: "c", IsDir: true},
+		{Path: "c/d e.pkg"},
+	}, paths)
+	paths, err = storage.List("")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(paths))
+	paths, err = storage.List("missing")
+	assert.Nil(t, err)
+	assert.Empty(t, paths)
+
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	assert.Nil(t, storage.Delete("plugins/a.pkg"))
+	exists, err = storage.Exists("plugins/a.pkg")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestWebDAVUnauthorized(t *testing.T) {
+	server := newServer(t, true)
+	storage, err := NewWebDAVStorage(oss.OSSArgs{WebDAV: &oss.WebDAV{Endpoint: server.URL + "/dav/dify/"}})
+	assert.Nil(t, err)
+	err = storage.Save("a.pkg", []byte("a"))
+	assert.Equal(t, errclass.Permission, errclass.Classify(err))
+}
+
+func TestWebDAVProvisioning(t *testing.T) {
+	server := newServer(t, false)
+	args := &oss.WebDAV{
+		Endpoint:     server.URL + "/dav/dify/",
+		Username:     "dify",
+		Password:     "secret",
+		Provisioning: oss.BucketProvisioning{Policy: oss.BucketPolicyRequireExisting},
+	}
+	_, err := NewWebDAVStorage(oss.OSSArgs{WebDAV: args})
+	assert.NotNil(t, err)
+
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing, Versioning: true}
+	_, err = NewWebDAVStorage(oss.OSSArgs{WebDAV: args})
+	assert.NotNil(t, err)
+
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyCreateIfMissing}
+	storage, err := NewWebDAVStorage(oss.OSSArgs{WebDAV: args})
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Save("a.pkg", []byte("a")))
+
+	args.Provisioning = oss.BucketProvisioning{Policy: oss.BucketPolicyRequireExisting}
+	_, err = NewWebDAVStorage(oss.OSSArgs{WebDAV: args})
+	assert.Nil(t, err)
+}
+
+func TestWebDAVValidate(t *testing.T) {
+	_, err := NewWebDAVStorage(oss.OSSArgs{WebDAV: &oss.WebDAV{}})
+	assert.NotNil(t, err)
+	_, err = NewWebDAVStorage(oss.OSSArgs{WebDAV: &oss.WebDAV{Endpoint: "ftp://nas/dify"}})
+	assert.NotNil(t, err)
+}
+
+func TestWebDAVWrappedErrors(t *testing.T) {
+	err := fmt.Errorf("load a: %w", &Error{StatusCode: http.StatusNotFound})
+	assert.True(t, hasStatus(err, http.StatusConflict, http.StatusNotFound))
+	assert.False(t, hasStatus(err, http.StatusConflict))
+}
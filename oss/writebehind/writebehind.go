@@ -0,0 +1,482 @@
+package writebehind
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+)
+
+const (
+	dataSuffix = ".data"
+	metaSuffix = ".meta"
+	tmpSuffix  = ".tmp"
+
+	defaultWorkers   = 4
+	defaultBaseDelay = 100 * time.Millisecond
+	defaultMaxDelay  = 30 * time.Second
+)
+
+// ErrClosed means a write was made after Close
+var ErrClosed = oss.NewCloudKitError("write-behind storage closed", "")
+
+type Options struct {
+	// Dir stores the journal, the writes left by a previous process are
+	// uploaded again when the storage is created
+	Dir string
+	// Workers is the number of concurrent uploads, defaults to 4
+	Workers int
+	// MaxAttempts is the number of attempts of an upload, zero retries until Close
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles on every retry, defaults to 100ms
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, defaults to 30s
+	MaxDelay time.Duration
+	// OnFailure is called when an upload is given up after MaxAttempts, the
+	// write stays in the journal and is uploaded again after a restart
+	OnFailure func(key string, err error)
+}
+
+// entry is a journaled write, it's persisted as <seq>.meta next to <seq>.data
+type entry struct {
+	Seq       uint64        `json:"seq"`
+	Key       string        `json:"key"`
+	Operation oss.Operation `json:"operation"`
+	Size      int64         `json:"size"`
+	Time      time.Time     `json:"time"`
+}
+
+type journal struct {
+	dir  string
+	opts Options
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	seq  uint64
+	// pending holds the latest write of every key which is not uploaded yet
+	pending  map[string]*entry
+	queue    []string
+	queued   map[string]bool
+	inflight map[string]bool
+	closed   bool
+	done     chan struct{}
+	workers  sync.WaitGroup
+}
+
+// WriteBehindStorage acknowledges Save and Delete once they are persisted in
+// a local journal and uploads them in the background. Only the latest write
+// of a key is uploaded, so a key never goes back to an older content. Reads
+// of the keys which are not uploaded yet are served from the journal.
+type WriteBehindStorage struct {
+	inner   oss.OSS
+	journal *journal
+}
+
+func NewWriteBehindStorage(inner oss.OSS, opts Options) (*WriteBehindStorage, error) {
+	if opts.Dir == "" {
+		return nil, oss.ErrArgumentInvalid.WithDetail("dir cannot be empty")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, oss.ErrProviderInit.WithError(err).WithDetail("failed to create journal dir")
+	}
+
+	j := &journal{
+		dir:      opts.Dir,
+		opts:     opts,
+		pending:  map[string]*entry{},
+		queued:   map[string]bool{},
+		inflight: map[string]bool{},
+		done:     make(chan struct{}),
+	}
+	j.cond = sync.NewCond(&j.mu)
+	if err := j.replay(); err != nil {
+		return nil, oss.ErrProviderInit.WithError(err).WithDetail("failed to replay journal")
+	}
+
+	w := &WriteBehindStorage{inner: inner, journal: j}
+	for i := 0; i < opts.Workers; i++ {
+		j.workers.Add(1)
+		go w.work()
+	}
+	return w, nil
+}
+
+func (j *journal) path(seq uint64, suffix string) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d", seq)+suffix)
+}
+
+// replay loads the writes which were not uploaded by a previous process
+func (j *journal) replay() error {
+	files, err := os.ReadDir(j.dir)
+	if err != nil {
+		return err
+	}
+
+	var entries []*entry
+	for _, file := range files {
+		name := file.Name()
+		switch {
+		case strings.HasSuffix(name, tmpSuffix):
+			os.Remove(filepath.Join(j.dir, name))
+		case strings.HasSuffix(name, metaSuffix):
+			raw, err := os.ReadFile(filepath.Join(j.dir, name))
+			if err != nil {
+				return err
+			}
+			e := &entry{}
+			if err := json.Unmarshal(raw, e); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		case strings.HasSuffix(name, dataSuffix):
+			// data without metadata was never acknowledged
+			seq, err := strconv.ParseUint(strings.TrimSuffix(name, dataSuffix), 10, 64)
+			if err == nil {
+				if _, err := os.Stat(j.path(seq, metaSuffix)); err != nil {
+					os.Remove(filepath.Join(j.dir, name))
+				}
+			}
+		}
+	}
+
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Seq < entries[b].Seq })
+	for _, e := range entries {
+		if previous, ok := j.pending[e.Key]; ok {
+			j.remove(previous)
+		}
+		j.pending[e.Key] = e
+		j.seq = max(j.seq, e.Seq)
+	}
+	for key := range j.pending {
+		j.enqueue(key)
+	}
+	return nil
+}
+
+// writeFile replaces the file atomically
+func (j *journal) writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(j.dir, filepath.Base(path)+"-*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (j *journal) remove(e *entry) {
+	os.Remove(j.path(e.Seq, metaSuffix))
+	os.Remove(j.path(e.Seq, dataSuffix))
+}
+
+// enqueue must be called with the lock held
+func (j *journal) enqueue(key string) {
+	if j.queued[key] || j.inflight[key] {
+		return
+	}
+	j.queued[key] = true
+	j.queue = append(j.queue, key)
+	j.cond.Signal()
+}
+
+// append persists a write, it's acknowledged once its metadata is written
+func (j *journal) append(op oss.Operation, key string, data []byte) error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return ErrClosed
+	}
+	j.seq++
+	e := &entry{Seq: j.seq, Key: key, Operation: op, Size: int64(len(data)), Time: time.Now()}
+	j.mu.Unlock()
+
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if op == oss.OperationSave {
+		if err := j.writeFile(j.path(e.Seq, dataSuffix), data); err != nil {
+			return err
+		}
+	}
+	if err := j.writeFile(j.path(e.Seq, metaSuffix), meta); err != nil {
+		os.Remove(j.path(e.Seq, dataSuffix))
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	previous, ok := j.pending[key]
+	if ok && previous.Seq > e.Seq {
+		// a later write of the key was journaled concurrently
+		j.remove(e)
+		return nil
+	}
+	if ok && !j.inflight[key] {
+		j.remove(previous)
+	}
+	j.pending[key] = e
+	j.enqueue(key)
+	return nil
+}
+
+// lookup returns the pending write of key
+func (j *journal) lookup(key string) (*entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.pending[key]
+	return e, ok
+}
+
+func (j *journal) backoff(attempt int) time.Duration {
+	delay := j.opts.BaseDelay << min(attempt-1, 30)
+	if delay <= 0 || delay > j.opts.MaxDelay {
+		delay = j.opts.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+func (w *WriteBehindStorage) work() {
+	j := w.journal
+	defer j.workers.Done()
+	for {
+		j.mu.Lock()
+		for len(j.queue) == 0 && !j.closed {
+			j.cond.Wait()
+		}
+		if j.closed {
+			j.mu.Unlock()
+			return
+		}
+		key := j.queue[0]
+		j.queue = j.queue[1:]
+		delete(j.queued, key)
+		j.inflight[key] = true
+		e := j.pending[key]
+		j.mu.Unlock()
+
+		err := w.upload(e)
+
+		j.mu.Lock()
+		delete(j.inflight, key)
+		latest := j.pending[key]
+		switch {
+		case err == nil && latest == e:
+			delete(j.pending, key)
+			j.remove(e)
+		case latest != e:
+			// the key was written again during the upload
+			j.remove(e)
+			j.enqueue(key)
+		}
+		j.cond.Broadcast()
+		j.mu.Unlock()
+	}
+}
+
+// upload retries a journaled write until it succeeds, MaxAttempts is reached or the journal is closed
+func (w *WriteBehindStorage) upload(e *entry) error {
+	j := w.journal
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = w.apply(e)
+		if err == nil {
+			return nil
+		}
+		if j.opts.MaxAttempts > 0 && attempt >= j.opts.MaxAttempts {
+			if j.opts.OnFailure != nil {
+				j.opts.OnFailure(e.Key, err)
+			}
+			return err
+		}
+		select {
+		case <-time.After(j.backoff(attempt)):
+		case <-j.done:
+			return err
+		}
+	}
+}
+
+func (w *WriteBehindStorage) apply(e *entry) error {
+	if e.Operation == oss.OperationDelete {
+		err := w.inner.Delete(e.Key)
+		if errclass.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := os.ReadFile(w.journal.path(e.Seq, dataSuffix))
+	if err != nil {
+		return err
+	}
+	return w.inner.Save(e.Key, data)
+}
+
+// Pending returns the number of keys which are not uploaded yet
+func (w *WriteBehindStorage) Pending() int {
+	w.journal.mu.Lock()
+	defer w.journal.mu.Unlock()
+	return len(w.journal.pending)
+}
+
+// Flush waits until no upload is queued or running, the given up uploads stay pending
+func (w *WriteBehindStorage) Flush() {
+	j := w.journal
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for (len(j.queue) > 0 || len(j.inflight) > 0) && !j.closed {
+		j.cond.Wait()
+	}
+}
+
+// Close stops the uploads, the pending writes stay in the journal and are
+// uploaded when a storage is created on the same Dir again
+func (w *WriteBehindStorage) Close() error {
+	j := w.journal
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	close(j.done)
+	j.cond.Broadcast()
+	j.mu.Unlock()
+	j.workers.Wait()
+	return nil
+}
+
+// WithContext returns a copy of the storage whose reads of uploaded keys use
+// ctx, the uploads are not bound to the context of the caller
+func (w *WriteBehindStorage) WithContext(ctx context.Context) oss.OSS {
+	return &WriteBehindStorage{
+		inner:   oss.WithContext(ctx, w.inner),
+		journal: w.journal,
+	}
+}
+
+func (w *WriteBehindStorage) Unwrap() oss.OSS {
+	return w.inner
+}
+
+func (w *WriteBehindStorage) Save(key string, data []byte) error {
+	return w.journal.append(oss.OperationSave, key, data)
+}
+
+func (w *WriteBehindStorage) Delete(key string) error {
+	return w.journal.append(oss.OperationDelete, key, nil)
+}
+
+func notFound(op oss.Operation, key string) error {
+	return &fs.PathError{Op: string(op), Path: key, Err: fs.ErrNotExist}
+}
+
+func (w *WriteBehindStorage) Load(key string) ([]byte, error) {
+	for {
+		e, ok := w.journal.lookup(key)
+		if !ok {
+			return w.inner.Load(key)
+		}
+		if e.Operation == oss.OperationDelete {
+			return nil, notFound(oss.OperationLoad, key)
+		}
+		data, err := os.ReadFile(w.journal.path(e.Seq, dataSuffix))
+		if err == nil {
+			return data, nil
+		}
+		// the file is gone if the entry was uploaded or superseded meanwhile
+		if latest, ok := w.journal.lookup(key); ok && latest == e {
+			return nil, err
+		}
+	}
+}
+
+func (w *WriteBehindStorage) Exists(key string) (bool, error) {
+	if e, ok := w.journal.lookup(key); ok {
+		return e.Operation == oss.OperationSave, nil
+	}
+	return w.inner.Exists(key)
+}
+
+func (w *WriteBehindStorage) State(key string) (oss.OSSState, error) {
+	if e, ok := w.journal.lookup(key); ok {
+		if e.Operation == oss.OperationDelete {
+			return oss.OSSState{}, notFound(oss.OperationState, key)
+		}
+		return oss.OSSState{Size: e.Size, LastModified: e.Time}, nil
+	}
+	return w.inner.State(key)
+}
+
+// List merges the pending writes below prefix into the paths of the storage
+func (w *WriteBehindStorage) List(prefix string) ([]oss.OSSPath, error) {
+	paths, err := w.inner.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	root := strings.Trim(prefix, "/")
+	if root != "" {
+		root += "/"
+	}
+	pending := map[string]oss.Operation{}
+	w.journal.mu.Lock()
+	for key, e := range w.journal.pending {
+		if strings.HasPrefix(key, root) {
+			pending[strings.TrimPrefix(key, root)] = e.Operation
+		}
+	}
+	w.journal.mu.Unlock()
+
+	merged := make([]oss.OSSPath, 0, len(paths)+len(pending))
+	for _, path := range paths {
+		if op, ok := pending[path.Path]; ok && !path.IsDir {
+			delete(pending, path.Path)
+			if op == oss.OperationDelete {
+				continue
+			}
+		}
+		merged = append(merged, path)
+	}
+	for path, op := range pending {
+		if op == oss.OperationSave {
+			merged = append(merged, oss.OSSPath{Path: path})
+		}
+	}
+	return merged, nil
+}
+
+func (w *WriteBehindStorage) Type() string {
+	return w.inner.Type()
+}
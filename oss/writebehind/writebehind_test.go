@@ -0,0 +1,126 @@
+package writebehind
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/langgenius/dify-cloud-kit/oss"
+	"github.com/langgenius/dify-cloud-kit/oss/errclass"
+	"github.com/langgenius/dify-cloud-kit/oss/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStorage fails the saves while blocked is set
+type blockingStorage struct {
+	oss.OSS
+	blocked atomic.Bool
+	saves   atomic.Int64
+}
+
+func (b *blockingStorage) Save(key string, data []byte) error {
+	b.saves.Add(1)
+	if b.blocked.Load() {
+		return errors.New("storage is down")
+	}
+	return b.OSS.Save(key, data)
+}
+
+func TestWriteBehindStorage(t *testing.T) {
+	inner := &blockingStorage{OSS: memory.New()}
+	inner.blocked.Store(true)
+	assert.Nil(t, inner.OSS.Save("uploads/old.txt", []byte("old")))
+
+	storage, err := NewWriteBehindStorage(inner, Options{Dir: t.TempDir()})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	// the writes are acknowledged and readable while the storage is down
+	assert.Nil(t, storage.Save("uploads/a.txt", []byte("v1")))
+	assert.Nil(t, storage.Save("uploads/a.txt", []byte("v2")))
+	assert.Nil(t, storage.Delete("uploads/old.txt"))
+
+	data, err := storage.Load("uploads/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), data)
+	state, err := storage.State("uploads/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), state.Size)
+	_, err = storage.Load("uploads/old.txt")
+	assert.True(t, errclass.IsNotFound(err))
+	exists, err := storage.Exists("uploads/old.txt")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	paths, err := storage.List("uploads")
+	assert.Nil(t, err)
+	assert.Equal(t, []oss.OSSPath{{Path: "a.txt"}}, paths)
+	assert.Equal(t, 2, storage.Pending())
+
+	inner.blocked.Store(false)
+	storage.Flush()
+	assert.Equal(t, 0, storage.Pending())
+
+	data, err = inner.Load("uploads/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), data)
+	exists, _ = inner.Exists("uploads/old.txt")
+	assert.False(t, exists)
+}
+
+func TestWriteBehindReplay(t *testing.T) {
+	dir := t.TempDir()
+	inner := &blockingStorage{OSS: memory.New()}
+	inner.blocked.Store(true)
+
+	storage, err := NewWriteBehindStorage(inner, Options{Dir: dir, MaxAttempts: 1})
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Save("a", []byte("first")))
+	assert.Nil(t, storage.Save("b", []byte("second")))
+	assert.Nil(t, storage.Save("a", []byte("third")))
+	storage.Flush()
+	assert.Nil(t, storage.Close())
+	assert.Equal(t, 2, storage.Pending())
+	assert.True(t, errors.Is(storage.Save("c", []byte("late")), ErrClosed))
+
+	// a new process uploads the journaled writes
+	inner.blocked.Store(false)
+	storage, err = NewWriteBehindStorage(inner, Options{Dir: dir})
+	assert.Nil(t, err)
+	defer storage.Close()
+	storage.Flush()
+	assert.Equal(t, 0, storage.Pending())
+
+	data, err := inner.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("third"), data)
+	data, err = inner.Load("b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), data)
+}
+
+func TestWriteBehindGiveUp(t *testing.T) {
+	inner := &blockingStorage{OSS: memory.New()}
+	inner.blocked.Store(true)
+
+	var failed []string
+	storage, err := NewWriteBehindStorage(inner, Options{
+		Dir:         t.TempDir(),
+		Workers:     1,
+		MaxAttempts: 3,
+		BaseDelay:   1,
+		OnFailure:   func(key string, err error) { failed = append(failed, key) },
+	})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	assert.Nil(t, storage.Save("a", []byte("data")))
+	storage.Flush()
+	assert.Equal(t, []string{"a"}, failed)
+	assert.Equal(t, int64(3), inner.saves.Load())
+
+	// the write is still served from the journal
+	data, err := storage.Load("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
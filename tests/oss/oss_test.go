@@ -29,6 +29,13 @@ var allCases = []testArgsCases{
 		},
 		skip: false,
 	},
+	{
+		vendor: "memory",
+		args: oss.OSSArgs{
+			Memory: &oss.Memory{},
+		},
+		skip: false,
+	},
 	{
 		vendor: "s3",
 		args: oss.OSSArgs{
@@ -118,6 +125,69 @@ var allCases = []testArgsCases{
 		},
 		skip: false,
 	},
+	{
+		vendor: "baidu",
+		args: oss.OSSArgs{
+			BaiduBOS: &oss.BaiduBOS{
+				Endpoint:  os.Getenv("BAIDU_BOS_ENDPOINT"),
+				AccessKey: os.Getenv("BAIDU_BOS_ACCESS_KEY"),
+				SecretKey: os.Getenv("BAIDU_BOS_SECRET_KEY"),
+				Bucket:    os.Getenv("BAIDU_BOS_BUCKET"),
+			},
+		},
+		skip: false,
+	},
+	{
+		vendor: "oci",
+		args: oss.OSSArgs{
+			OCIObjectStorage: &oss.OCIObjectStorage{
+				Region:      os.Getenv("OCI_REGION"),
+				Namespace:   os.Getenv("OCI_NAMESPACE"),
+				Bucket:      os.Getenv("OCI_BUCKET"),
+				UseS3Compat: true,
+				AccessKey:   os.Getenv("OCI_ACCESS_KEY"),
+				SecretKey:   os.Getenv("OCI_SECRET_KEY"),
+			},
+		},
+		skip: false,
+	},
+	{
+		vendor: "supabase",
+		args: oss.OSSArgs{
+			Supabase: &oss.Supabase{
+				URL:        os.Getenv("SUPABASE_URL"),
+				ServiceKey: os.Getenv("SUPABASE_SERVICE_KEY"),
+				Bucket:     os.Getenv("SUPABASE_BUCKET"),
+			},
+		},
+		skip: false,
+	},
+	{
+		vendor: "swift",
+		args: oss.OSSArgs{
+			OpenStackSwift: &oss.OpenStackSwift{
+				AuthURL:    os.Getenv("SWIFT_AUTH_URL"),
+				UserName:   os.Getenv("SWIFT_USERNAME"),
+				Password:   os.Getenv("SWIFT_PASSWORD"),
+				UserDomain: os.Getenv("SWIFT_USER_DOMAIN"),
+				Project:    os.Getenv("SWIFT_PROJECT"),
+				Region:     os.Getenv("SWIFT_REGION"),
+				Container:  os.Getenv("SWIFT_CONTAINER"),
+			},
+		},
+		skip: false,
+	},
+	{
+		vendor: "webdav",
+		args: oss.OSSArgs{
+			WebDAV: &oss.WebDAV{
+				Endpoint: os.Getenv("WEBDAV_ENDPOINT"),
+				Username: os.Getenv("WEBDAV_USERNAME"),
+				Password: os.Getenv("WEBDAV_PASSWORD"),
+			},
+		},
+		skip: false,
+	},
 }
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"